@@ -1,9 +1,17 @@
 package cmd
 
 import (
+	"log"
+	"strings"
+
 	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/cmd/configcmd"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/cmd/consul"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/cmd/hosts"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/cmd/nomad"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/cmd/secretscmd"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/runlog"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
 )
 
 var App = &cli.App{
@@ -12,5 +20,43 @@ var App = &cli.App{
 	Commands: []*cli.Command{
 		consul.Cmd,
 		nomad.Cmd,
+		hosts.Cmd,
+		configcmd.Cmd,
+		secretscmd.Cmd,
+	},
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "show stdout of remote commands, not only stderr",
+		},
+	},
+	Before: func(c *cli.Context) error {
+		ssh.SetContext(c.Context)
+		runlog.Verbose = c.Bool("verbose")
+		runlog.SetStep(commandName(c.Args().Slice()))
+		return nil
 	},
+	After: func(c *cli.Context) error {
+		ssh.Close()
+		runlog.Close()
+		if dir := runlog.Dir(); dir != "" {
+			log.Printf("Output of remote commands is saved in %s\n", dir)
+		}
+		if report := ssh.RetryReport(); report != "" {
+			log.Printf("Retried operations per host: %s\n", report)
+		}
+		return nil
+	},
+}
+
+// commandName returns subcommand words of command line, like "consul up"
+func commandName(args []string) string {
+	words := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			break
+		}
+		words = append(words, arg)
+	}
+	return strings.Join(words, " ")
 }
@@ -0,0 +1,29 @@
+package configcmd
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+var Cmd = &cli.Command{
+	Name:  "config",
+	Usage: "config file management",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "validate",
+			Description: "Check config file for unknown fields, invalid values and duplicate hosts",
+			Action:      Validate,
+		},
+		{
+			Name:        "migrate",
+			Description: "Upgrade config file to the current schema version, keeping a backup",
+			Action:      Migrate,
+		},
+		{
+			Name:        "import",
+			Description: "Take hosts from Ansible inventory, terraform output -json or Vagrantfile",
+			ArgsUsage:   "<file>",
+			Flags:       importFlags,
+			Action:      Import,
+		},
+	},
+}
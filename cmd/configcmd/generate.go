@@ -0,0 +1,124 @@
+package configcmd
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// GenerateFlags answer survey questions in advance
+var GenerateFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "dc",
+		Usage: "name of datacenter",
+	},
+	&cli.StringSliceFlag{
+		Name:  "server",
+		Usage: "server hosts as address[:port][@user], address can be range or CIDR, can be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "client",
+		Usage: "client hosts as address[:port][@user], address can be range or CIDR, can be repeated",
+	},
+	&cli.StringFlag{
+		Name:  "version",
+		Usage: "binary version",
+	},
+	&cli.BoolFlag{
+		Name:  "gossip",
+		Usage: "enable gossip encryption",
+	},
+	&cli.BoolFlag{
+		Name:  "tls",
+		Usage: "enable tls encryption",
+	},
+	&cli.BoolFlag{
+		Name:  "acl",
+		Usage: "enable acl",
+	},
+	&cli.StringFlag{
+		Name:  "ssh-key",
+		Usage: "private SSH key",
+	},
+	&cli.BoolFlag{
+		Name:  "check-reachability",
+		Usage: "check that SSH ports of hosts are reachable before saving",
+	},
+	&cli.BoolFlag{
+		Name:  "new",
+		Usage: "start from scratch instead of editing existing config",
+	},
+	&cli.BoolFlag{
+		Name:  "non-interactive",
+		Usage: "don't ask anything, fail when dc, servers or version are missing",
+	},
+}
+
+// Generate generates config via survey, skipping questions answered
+// by flags
+func Generate(c *cli.Context) error {
+	answers := config.Answers{
+		DCName:            c.String("dc"),
+		BinaryVersion:     c.String("version"),
+		SSHKey:            c.String("ssh-key"),
+		GossipEnabled:     boolFlag(c, "gossip"),
+		TLSEnabled:        boolFlag(c, "tls"),
+		ACLEnabled:        boolFlag(c, "acl"),
+		CheckReachability: boolFlag(c, "check-reachability"),
+		NonInteractive:    c.Bool("non-interactive"),
+	}
+	for _, spec := range c.StringSlice("server") {
+		hosts, err := config.ParseHosts(spec)
+		if err != nil {
+			return err
+		}
+		answers.Servers = append(answers.Servers, hosts...)
+	}
+	for _, spec := range c.StringSlice("client") {
+		hosts, err := config.ParseHosts(spec)
+		if err != nil {
+			return err
+		}
+		answers.Clients = append(answers.Clients, hosts...)
+	}
+
+	_, err := os.Stat(config.File)
+	if err == nil && !c.Bool("new") {
+		return edit(answers)
+	}
+	cfg, err := config.Survey(answers)
+	if err != nil {
+		return err
+	}
+	return cfg.Save()
+}
+
+// edit runs survey over existing config, keeping settings which
+// are not asked about
+func edit(answers config.Answers) error {
+	existing, err := config.Load()
+	if err != nil {
+		return err
+	}
+	cfg, err := config.Edit(existing, answers)
+	if errors.Is(err, config.ErrNotSaved) {
+		log.Println(err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cfg.Save()
+}
+
+// boolFlag returns value of the flag if it is set, nil otherwise
+func boolFlag(c *cli.Context, name string) *bool {
+	if !c.IsSet(name) {
+		return nil
+	}
+	value := c.Bool(name)
+	return &value
+}
@@ -0,0 +1,64 @@
+package configcmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/inventory"
+)
+
+var importFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "from",
+		Usage:    "inventory format: ansible, terraform or vagrant",
+		Required: true,
+	},
+	&cli.StringSliceFlag{
+		Name:  "group",
+		Usage: "role=group mapping like server=masters, can be repeated",
+	},
+}
+
+// Import replaces hosts of config with hosts of foreign inventory,
+// other settings of existing config are kept
+func Import(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("inventory file must be specified")
+	}
+	mapping, err := inventory.ParseMapping(c.StringSlice("group"))
+	if err != nil {
+		return err
+	}
+	groups, err := inventory.Load(c.String("from"), c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	existing := &config.Config{DCName: "dc1", BinaryVersion: "1.10.0", SSHKey: "~/.ssh/id_rsa"}
+	if _, err := os.Stat(config.File); err == nil {
+		existing, err = config.Load()
+		if err != nil {
+			return err
+		}
+	}
+	cfg := *existing
+	if err := inventory.Apply(&cfg, groups, mapping); err != nil {
+		return err
+	}
+
+	diff, err := config.Diff(existing, &cfg)
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		log.Println("Hosts are up to date")
+		return nil
+	}
+	fmt.Print(diff)
+	log.Printf("Imported %d server(s) and %d client(s)\n", len(cfg.Servers), len(cfg.Clients))
+	return cfg.Save()
+}
@@ -0,0 +1,20 @@
+package configcmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// Migrate upgrades config file to the schema version of this binary
+func Migrate(c *cli.Context) error {
+	migrated, err := config.Migrate()
+	if err != nil {
+		return err
+	}
+	if !migrated {
+		fmt.Printf("%s is up to date (schema version %d)\n", config.File, config.SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package configcmd
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+func Validate(c *cli.Context) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid\n", config.File)
+	return nil
+}
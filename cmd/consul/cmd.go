@@ -2,6 +2,7 @@ package consul
 
 import (
 	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/cmd/configcmd"
 )
 
 var Cmd = &cli.Command{
@@ -11,16 +12,42 @@ var Cmd = &cli.Command{
 		{
 			Name:        "up",
 			Description: "Deploy consul cluster",
+			Flags:       upFlags,
 			Action:      Up,
 		},
 		{
 			Name:        "config",
-			Description: "Generate config via interactive survey",
-			Action:      GenerateConfig,
+			Description: "Generate config via interactive survey or flags",
+			Flags:       configcmd.GenerateFlags,
+			Action:      configcmd.Generate,
+		},
+		{
+			Name:        "status",
+			Description: "Show what was deployed according to local state",
+			Action:      Status,
+		},
+		snapshotCmd,
+		{
+			Name:        "logs",
+			Description: "Show consul journal of cluster hosts",
+			Flags:       logsFlags,
+			Action:      Logs,
+		},
+		{
+			Name:        "support-bundle",
+			Description: "Gather logs, configs and status of every host into tar.gz",
+			Flags:       supportBundleFlags,
+			Action:      SupportBundle,
+		},
+		{
+			Name:        "rollback",
+			Description: "Restore files overwritten by the last deploy",
+			Action:      Rollback,
 		},
 		{
 			Name:        "remove",
 			Description: "Clear all consul traces",
+			Flags:       removeFlags,
 			Action:      Remove,
 		},
 	},
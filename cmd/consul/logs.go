@@ -0,0 +1,76 @@
+package consul
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/consul/deploy"
+)
+
+var logsFlags = []cli.Flag{
+	&cli.DurationFlag{
+		Name:  "since",
+		Usage: "show journal entries not older than this",
+		Value: time.Hour,
+	},
+	&cli.BoolFlag{
+		Name:  "follow",
+		Usage: "keep printing new journal entries until interrupted",
+	},
+	&cli.StringFlag{
+		Name:  "role",
+		Usage: "show logs of server or client hosts only",
+	},
+	&cli.StringFlag{
+		Name:  "selector",
+		Usage: "show logs of hosts matching labels selector like rack=r1,nodeClass!=gpu",
+	},
+}
+
+var supportBundleFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "output",
+		Usage: "path of the archive",
+		Value: fmt.Sprintf("consul-support-%s.tar.gz", time.Now().Format("20060102-150405")),
+	},
+	&cli.DurationFlag{
+		Name:  "since",
+		Usage: "include journal entries not older than this",
+		Value: 24 * time.Hour,
+	},
+}
+
+// Logs prints consul journal of selected hosts. It doesn't lock
+// cluster state, so logs can be followed during deploy.
+func Logs(c *cli.Context) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	hosts, err := cfg.Select(c.String("role"), c.String("selector"))
+	if err != nil {
+		return err
+	}
+
+	deployer := &deploy.Consul{Cfg: cfg}
+	err = deployer.Logs(hosts, c.Duration("since"), c.Bool("follow"), os.Stdout)
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+func SupportBundle(c *cli.Context) error {
+	return withDeployer(func(deployer *deploy.Consul) error {
+		if err := deployer.SupportBundle(c.String("output"), c.Duration("since")); err != nil {
+			return err
+		}
+		fmt.Printf("Support bundle is saved to %s\n", c.String("output"))
+		return nil
+	})
+}
@@ -1,21 +1,58 @@
 package consul
 
 import (
+	"errors"
 	"log"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/consul/deploy"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
 )
 
+var removeFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "force",
+		Usage: "don't ask for confirmation and destroy data even if agents failed to leave",
+	},
+	&cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "how long to wait for agents to leave the cluster",
+		Value: 5 * time.Minute,
+	},
+}
+
 func Remove(c *cli.Context) error {
+	if !c.Bool("force") && !config.Confirm("Stop consul on all hosts and destroy its data?") {
+		return errors.New("aborted by user")
+	}
+
 	log.Println("Reading config consul.yaml")
 	config, err := config.Load()
 	if err != nil {
 		return err
 	}
 
-	deployer := deploy.Consul{Cfg: config}
+	st, err := state.Open(config.DCName)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	sec, err := secrets.Open(st)
+	if err != nil {
+		return err
+	}
+	deployer := deploy.Consul{Cfg: config, State: st.Component("consul"), Secrets: sec.Component("consul")}
+
+	log.Println("Leaving cluster")
+	if err := deployer.Leave(c.Duration("timeout")); err != nil {
+		if !c.Bool("force") {
+			return err
+		}
+		log.Println("Ignoring:", err)
+	}
 
 	log.Println("Stopping and deleting services")
 	if err := deployer.DeleteServices(); err != nil {
@@ -32,6 +69,12 @@ func Remove(c *cli.Context) error {
 		return err
 	}
 
+	sec.Delete("consul")
+	st.Delete("consul")
+	if err := st.Save(); err != nil {
+		return err
+	}
+
 	log.Println("Done!")
 	return nil
 }
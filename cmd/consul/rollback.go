@@ -0,0 +1,35 @@
+package consul
+
+import (
+	"log"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/consul/deploy"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+func Rollback(c *cli.Context) error {
+	config, err := config.Load()
+	if err != nil {
+		return err
+	}
+	st, err := state.Open(config.DCName)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	deployer := deploy.Consul{Cfg: config, State: st.Component("consul")}
+	log.Println("Restoring files overwritten by the last deploy")
+	err = deployer.Rollback()
+	if saveErr := st.Save(); err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Println("Done!")
+	return nil
+}
@@ -7,70 +7,115 @@ import (
 	"github.com/urfave/cli/v2"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/consul/deploy"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/pipeline"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
 )
 
+var upFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "resume",
+		Usage: "continue failed deploy, skipping steps and hosts already done",
+	},
+	&cli.StringFlag{
+		Name:  "from-step",
+		Usage: "skip all steps before the named one",
+	},
+	&cli.StringFlag{
+		Name:  "only-step",
+		Usage: "run the named step only",
+	},
+	&cli.BoolFlag{
+		Name:  "rollback-on-failure",
+		Usage: "restore files overwritten on all touched hosts if deploy fails",
+	},
+	&cli.BoolFlag{
+		Name:  "list-steps",
+		Usage: "show deployment plan and progress of the last run",
+	},
+}
+
 func Up(c *cli.Context) error {
 	log.Println("Reading config consul.yaml")
+	if err := config.Validate(); err != nil {
+		return err
+	}
 	config, err := config.Load()
 	if err != nil {
 		return err
 	}
-
-	log.Printf("Downloading consul v%s from releases.hashicorp.com\n", config.BinaryVersion)
-	deployer, err := deploy.NewDeployer(config)
+	changed, err := ssh.ResolveNames(config, false)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(deployer.ConsulBinPath)
+	if changed {
+		if err := config.Save(); err != nil {
+			return err
+		}
+	}
 
-	log.Println("Deploying consul binary to all agents")
-	if err := deployer.DeployBinary(); err != nil {
+	log.Printf("Locking state of cluster %s\n", config.DCName)
+	st, err := state.Open(config.DCName)
+	if err != nil {
 		return err
 	}
+	defer st.Close()
 
-	log.Println("Deploying service files to all agents")
-	if err := deployer.DeployServices(); err != nil {
-		return err
+	if c.Bool("list-steps") {
+		deployer := &deploy.Consul{Cfg: config, State: st.Component("consul")}
+		p := pipeline.Pipeline{Cfg: config, State: st, Component: "consul", Steps: deployer.Steps()}
+		return p.List(os.Stdout)
 	}
 
-	log.Println("Create config directory on all agents")
-	if err := deployer.CreateDir("/etc/consul.d/"); err != nil {
+	sec, err := secrets.Open(st)
+	if err != nil {
 		return err
 	}
-
-	log.Println("Deploying consul configs to all agents")
-	if err := deployer.DeployConsulConfigs(); err != nil {
+	if err := sec.Unlock(); err != nil {
 		return err
 	}
 
-	log.Println("Generating TLS certificates")
-	certDir, err := deployer.GenerateCertificates()
+	log.Printf("Downloading consul v%s from releases.hashicorp.com\n", config.BinaryVersion)
+	deployer, err := deploy.NewDeployer(config)
 	if err != nil {
 		return err
 	}
+	defer os.Remove(deployer.ConsulBinPath)
+	deployer.State = st.Component("consul")
+	deployer.Secrets = sec.Component("consul")
+	// secrets are saved along with state
+	defer st.Save()
 
-	log.Println("Deploying TLS certificates")
-	if err = deployer.DeployCertificates(certDir); err != nil {
-		return err
-	}
-	if err = os.RemoveAll(certDir); err != nil {
-		return err
+	if !c.Bool("resume") {
+		log.Println("Deleting backups made by previous deploy")
+		if err := deployer.PruneBackups(); err != nil {
+			return err
+		}
 	}
 
-	log.Println("Creating data directories on all agents")
-	if err = deployer.CreateDir("/opt/consul/"); err != nil {
+	p := pipeline.Pipeline{Cfg: config, State: st, Component: "consul", Steps: deployer.Steps()}
+	err = p.Run(pipeline.Options{
+		Resume:   c.Bool("resume"),
+		FromStep: c.String("from-step"),
+		OnlyStep: c.String("only-step"),
+	})
+	if err != nil && c.Bool("rollback-on-failure") {
+		log.Println(err)
+		log.Println("Deploy failed, rolling back")
+		if rollbackErr := deployer.Rollback(); rollbackErr != nil {
+			log.Println("Rollback failed:", rollbackErr)
+		}
+	}
+	if err != nil {
 		return err
 	}
 
-	log.Println("Enabling and starting consul services on all agents")
-	if err = deployer.StartServices(); err != nil {
+	log.Println("Deleting backups of overwritten files")
+	if err := deployer.PruneBackups(); err != nil {
 		return err
 	}
 
 	log.Println("Done!")
-
-	if err = deployer.PrintBootstrapTokenInfo(); err != nil {
-		return err
-	}
 	return nil
 }
@@ -0,0 +1,34 @@
+package hosts
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+var Cmd = &cli.Command{
+	Name:  "hosts",
+	Usage: "cluster hosts management",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "trust",
+			Description: "Scan host keys and record them in project known_hosts",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "yes",
+					Usage: "trust new keys without confirmation",
+				},
+			},
+			Action: Trust,
+		},
+		{
+			Name:        "names",
+			Description: "Set missing agent names to remote hostnames",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "replace all agent names, not only missing ones",
+				},
+			},
+			Action: Names,
+		},
+	},
+}
@@ -0,0 +1,26 @@
+package hosts
+
+import (
+	"log"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+// Names sets agent names of hosts to their remote hostnames
+func Names(c *cli.Context) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	changed, err := ssh.ResolveNames(cfg, c.Bool("all"))
+	if err != nil {
+		return err
+	}
+	if !changed {
+		log.Println("Agent names are up to date")
+		return nil
+	}
+	return cfg.Save()
+}
@@ -0,0 +1,59 @@
+package hosts
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+func Trust(c *cli.Context) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	known, err := ssh.KnownHostKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range ssh.Endpoints(cfg) {
+		log.Printf("Scanning host keys of %s\n", endpoint)
+		keys, err := ssh.Keyscan(cfg, endpoint)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", endpoint, err)
+		}
+
+		newKeys := []ssh.HostKey{}
+		for _, key := range keys {
+			isKnown, err := ssh.CheckHostKey(known, key)
+			if err != nil {
+				return err
+			}
+			if !isKnown {
+				newKeys = append(newKeys, key)
+			}
+		}
+		if len(newKeys) == 0 {
+			log.Println("Already trusted")
+			continue
+		}
+
+		for _, key := range newKeys {
+			fmt.Printf("    %s %s %s\n", key.Host, key.Type, key.Fingerprint())
+		}
+		if !c.Bool("yes") && !config.Confirm(fmt.Sprintf("Trust keys of %s?", endpoint)) {
+			log.Printf("Skipping %s\n", endpoint)
+			continue
+		}
+		if err := ssh.Trust(newKeys); err != nil {
+			return err
+		}
+		known = append(known, newKeys...)
+	}
+
+	log.Printf("Done! Host keys are stored in %s\n", ssh.KnownHostsFile)
+	return nil
+}
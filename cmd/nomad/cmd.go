@@ -2,6 +2,7 @@ package nomad
 
 import (
 	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/cmd/configcmd"
 )
 
 var Cmd = &cli.Command{
@@ -11,16 +12,43 @@ var Cmd = &cli.Command{
 		{
 			Name:        "up",
 			Description: "Deploy nomad cluster",
+			Flags:       upFlags,
 			Action:      Up,
 		},
 		{
 			Name:        "config",
-			Description: "Generate config via interactive survey",
-			Action:      GenerateConfig,
+			Description: "Generate config via interactive survey or flags",
+			Flags:       configcmd.GenerateFlags,
+			Action:      configcmd.Generate,
+		},
+		{
+			Name:        "status",
+			Description: "Show what was deployed according to local state",
+			Action:      Status,
+		},
+		snapshotCmd,
+		{
+			Name:        "exec",
+			Description: "Run shell command on cluster hosts in parallel",
+			ArgsUsage:   "-- <command>",
+			Flags:       execFlags,
+			Action:      Exec,
+		},
+		{
+			Name:        "ssh",
+			Description: "Open interactive SSH session to the host",
+			ArgsUsage:   "<agentName>",
+			Action:      Ssh,
+		},
+		{
+			Name:        "rollback",
+			Description: "Restore files overwritten by the last deploy",
+			Action:      Rollback,
 		},
 		{
 			Name:        "remove",
 			Description: "Clear all nomad traces",
+			Flags:       removeFlags,
 			Action:      Remove,
 		},
 	},
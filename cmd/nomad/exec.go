@@ -0,0 +1,98 @@
+package nomad
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+var execFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "role",
+		Usage: "run on server or client hosts only",
+	},
+	&cli.StringFlag{
+		Name:  "selector",
+		Usage: "run on hosts matching labels selector like rack=r1,nodeClass!=gpu",
+	},
+}
+
+type execResult struct {
+	output   string
+	exitCode int
+	err      error
+}
+
+// Exec runs shell command on selected hosts in parallel and prints
+// output of every host with its exit code
+func Exec(c *cli.Context) error {
+	command := strings.Join(c.Args().Slice(), " ")
+	if command == "" {
+		return fmt.Errorf("command is required: nomad-deploy nomad exec -- <command>")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	hosts, err := cfg.Select(c.String("role"), c.String("selector"))
+	if err != nil {
+		return err
+	}
+
+	results := make([]execResult, len(hosts))
+	wg := sync.WaitGroup{}
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host config.Host) {
+			defer wg.Done()
+			output, exitCode, err := ssh.Output(host, cfg, command)
+			results[i] = execResult{output: output, exitCode: exitCode, err: err}
+		}(i, host)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, host := range hosts {
+		result := results[i]
+		switch {
+		case result.err != nil:
+			failed++
+			fmt.Printf("=== %s (%s): %s\n", host.AgentName, host.Address, result.err)
+		case result.exitCode != 0:
+			failed++
+			fmt.Printf("=== %s (%s): exit code %d\n", host.AgentName, host.Address, result.exitCode)
+		default:
+			fmt.Printf("=== %s (%s): ok\n", host.AgentName, host.Address)
+		}
+		fmt.Print(result.output)
+		if result.output != "" && !strings.HasSuffix(result.output, "\n") {
+			fmt.Println()
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d of %d hosts", failed, len(hosts))
+	}
+	return nil
+}
+
+// Ssh opens interactive session to the host with the agent name
+func Ssh(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("agent name is required: nomad-deploy nomad ssh <agentName>")
+	}
+
+	config, err := config.Load()
+	if err != nil {
+		return err
+	}
+	host, err := config.Host(c.Args().First())
+	if err != nil {
+		return err
+	}
+	return ssh.Interactive(host, config)
+}
@@ -1,20 +1,66 @@
 package nomad
 
 import (
+	"errors"
 	"log"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/nomad/deploy"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
 )
 
+var removeFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "force",
+		Usage: "don't ask for confirmation and destroy data even if agents failed to leave",
+	},
+	&cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "how long to wait for agents to leave the cluster",
+		Value: 5 * time.Minute,
+	},
+}
+
 func Remove(c *cli.Context) error {
+	if !c.Bool("force") && !config.Confirm("Stop nomad on all hosts and destroy its data?") {
+		return errors.New("aborted by user")
+	}
+
 	log.Println("Reading config nomad.yaml")
 	config, err := config.Load()
 	if err != nil {
 		return err
 	}
-	deployer := deploy.Nomad{Cfg: config}
+
+	st, err := state.Open(config.DCName)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	sec, err := secrets.Open(st)
+	if err != nil {
+		return err
+	}
+	deployer := deploy.Nomad{Cfg: config, State: st.Component("nomad"), Secrets: sec.Component("nomad")}
+
+	log.Println("Draining client nodes")
+	if err := deployer.Drain(c.Duration("timeout")); err != nil {
+		if !c.Bool("force") {
+			return err
+		}
+		log.Println("Ignoring:", err)
+	}
+
+	log.Println("Removing servers from cluster")
+	if err := deployer.LeaveServers(c.Duration("timeout")); err != nil {
+		if !c.Bool("force") {
+			return err
+		}
+		log.Println("Ignoring:", err)
+	}
 
 	log.Println("Stopping and deleting services")
 	if err := deployer.DeleteSystemd(); err != nil {
@@ -31,6 +77,12 @@ func Remove(c *cli.Context) error {
 		return err
 	}
 
+	sec.Delete("nomad")
+	st.Delete("nomad")
+	if err := st.Save(); err != nil {
+		return err
+	}
+
 	log.Println("Done!")
 	return nil
 }
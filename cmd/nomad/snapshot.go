@@ -0,0 +1,102 @@
+package nomad
+
+import (
+	"errors"
+	"log"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/nomad/deploy"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+var snapshotCmd = &cli.Command{
+	Name:  "snapshot",
+	Usage: "nomad state snapshots",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "save",
+			Description: "Save snapshot of cluster state into local file",
+			ArgsUsage:   "<file>",
+			Action:      SnapshotSave,
+		},
+		{
+			Name:        "restore",
+			Description: "Restore cluster state from local snapshot file",
+			ArgsUsage:   "<file>",
+			Action:      SnapshotRestore,
+		},
+		{
+			Name:        "schedule",
+			Description: "Install systemd timer saving rotated snapshots on servers",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "interval",
+					Usage: "systemd calendar expression",
+					Value: "hourly",
+				},
+				&cli.IntFlag{
+					Name:  "keep",
+					Usage: "number of snapshots kept on every server",
+					Value: 24,
+				},
+			},
+			Action: SnapshotSchedule,
+		},
+	},
+}
+
+func SnapshotSave(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return errors.New("snapshot file must be specified")
+	}
+	return withDeployer(func(deployer *deploy.Nomad) error {
+		return deployer.SaveSnapshot(c.Args().First())
+	})
+}
+
+func SnapshotRestore(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return errors.New("snapshot file must be specified")
+	}
+	return withDeployer(func(deployer *deploy.Nomad) error {
+		return deployer.RestoreSnapshot(c.Args().First())
+	})
+}
+
+func SnapshotSchedule(c *cli.Context) error {
+	return withDeployer(func(deployer *deploy.Nomad) error {
+		return deployer.ScheduleSnapshots(c.String("interval"), c.Int("keep"))
+	})
+}
+
+// withDeployer runs action on deployer of already deployed cluster,
+// which doesn't need nomad binary locally
+func withDeployer(action func(deployer *deploy.Nomad) error) error {
+	config, err := config.Load()
+	if err != nil {
+		return err
+	}
+	st, err := state.Open(config.DCName)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	sec, err := secrets.Open(st)
+	if err != nil {
+		return err
+	}
+
+	deployer := &deploy.Nomad{
+		Cfg:       config,
+		State:     st.Component("nomad"),
+		Secrets:   sec.Component("nomad"),
+		Templates: deploy.Templates,
+	}
+	if err := action(deployer); err != nil {
+		return err
+	}
+	log.Println("Done!")
+	return nil
+}
@@ -0,0 +1,23 @@
+package nomad
+
+import (
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+func Status(c *cli.Context) error {
+	config, err := config.Load()
+	if err != nil {
+		return err
+	}
+	// status only shows state, so it works during deploy as well
+	st, err := state.Read(config.DCName)
+	if err != nil {
+		return err
+	}
+
+	return st.Print(os.Stdout, "nomad")
+}
@@ -7,63 +7,115 @@ import (
 	"github.com/urfave/cli/v2"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/nomad/deploy"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/pipeline"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
 )
 
+var upFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "resume",
+		Usage: "continue failed deploy, skipping steps and hosts already done",
+	},
+	&cli.StringFlag{
+		Name:  "from-step",
+		Usage: "skip all steps before the named one",
+	},
+	&cli.StringFlag{
+		Name:  "only-step",
+		Usage: "run the named step only",
+	},
+	&cli.BoolFlag{
+		Name:  "rollback-on-failure",
+		Usage: "restore files overwritten on all touched hosts if deploy fails",
+	},
+	&cli.BoolFlag{
+		Name:  "list-steps",
+		Usage: "show deployment plan and progress of the last run",
+	},
+}
+
 func Up(c *cli.Context) error {
 	log.Println("Reading config nomad.yaml")
+	if err := config.Validate(); err != nil {
+		return err
+	}
 	config, err := config.Load()
 	if err != nil {
 		return err
 	}
-
-	log.Printf("Downloading nomad v%s from releases.hashicorp.com\n", config.BinaryVersion)
-	deployer, err := deploy.NewDeployer(config)
+	changed, err := ssh.ResolveNames(config, false)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(deployer.NomadBinPath)
+	if changed {
+		if err := config.Save(); err != nil {
+			return err
+		}
+	}
 
-	log.Println("Deploying nomad binary to all agents")
-	if err := deployer.DeployBinary(); err != nil {
+	log.Printf("Locking state of cluster %s\n", config.DCName)
+	st, err := state.Open(config.DCName)
+	if err != nil {
 		return err
 	}
+	defer st.Close()
 
-	log.Println("Deploying systemd service file to all agents")
-	if err := deployer.DeploySystemd(); err != nil {
-		return err
+	if c.Bool("list-steps") {
+		deployer := &deploy.Nomad{Cfg: config, State: st.Component("nomad")}
+		p := pipeline.Pipeline{Cfg: config, State: st, Component: "nomad", Steps: deployer.Steps()}
+		return p.List(os.Stdout)
 	}
 
-	log.Println("Create config directory on all agents")
-	if err := deployer.CreateDir("/etc/nomad.d/"); err != nil {
+	sec, err := secrets.Open(st)
+	if err != nil {
 		return err
 	}
-
-	log.Println("Deploying common nomad config to all agents")
-	if err := deployer.DeployBaseConfig(); err != nil {
+	if err := sec.Unlock(); err != nil {
 		return err
 	}
 
-	log.Println("Deploying server config to all agents")
-	if err := deployer.DeployServerConfig(); err != nil {
+	log.Printf("Downloading nomad v%s from releases.hashicorp.com\n", config.BinaryVersion)
+	deployer, err := deploy.NewDeployer(config)
+	if err != nil {
 		return err
 	}
+	defer os.Remove(deployer.NomadBinPath)
+	deployer.State = st.Component("nomad")
+	deployer.Secrets = sec.Component("nomad")
+	// secrets are saved along with state
+	defer st.Save()
 
-	log.Println("Deploying client config to all agents")
-	if err := deployer.DeployClientConfig(); err != nil {
-		return err
+	if !c.Bool("resume") {
+		log.Println("Deleting backups made by previous deploy")
+		if err := deployer.PruneBackups(); err != nil {
+			return err
+		}
 	}
 
-	log.Println("Creating data directories on all agents")
-	if err = deployer.CreateDir("/opt/nomad/"); err != nil {
+	p := pipeline.Pipeline{Cfg: config, State: st, Component: "nomad", Steps: deployer.Steps()}
+	err = p.Run(pipeline.Options{
+		Resume:   c.Bool("resume"),
+		FromStep: c.String("from-step"),
+		OnlyStep: c.String("only-step"),
+	})
+	if err != nil && c.Bool("rollback-on-failure") {
+		log.Println(err)
+		log.Println("Deploy failed, rolling back")
+		if rollbackErr := deployer.Rollback(); rollbackErr != nil {
+			log.Println("Rollback failed:", rollbackErr)
+		}
+	}
+	if err != nil {
 		return err
 	}
 
-	log.Println("Enabling and starting nomad systemd services on all agents")
-	if err = deployer.StartSystemd(); err != nil {
+	log.Println("Deleting backups of overwritten files")
+	if err := deployer.PruneBackups(); err != nil {
 		return err
 	}
 
 	log.Println("Done!")
-
 	return nil
 }
@@ -0,0 +1,36 @@
+package secretscmd
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+var componentFlag = &cli.StringFlag{
+	Name:  "component",
+	Usage: "consul or nomad, both by default",
+}
+
+var Cmd = &cli.Command{
+	Name:  "secrets",
+	Usage: "generated cluster secrets",
+	Subcommands: []*cli.Command{
+		{
+			Name:        "show",
+			Description: "Print gossip keys, CA and ACL bootstrap tokens from encrypted secrets file",
+			Flags:       []cli.Flag{componentFlag},
+			Action:      Show,
+		},
+		{
+			Name:        "export",
+			Description: "Write secrets into separate files usable as file: references of config",
+			Flags: []cli.Flag{
+				componentFlag,
+				&cli.StringFlag{
+					Name:  "dir",
+					Usage: "directory to write files to",
+					Value: "secrets",
+				},
+			},
+			Action: Export,
+		},
+	},
+}
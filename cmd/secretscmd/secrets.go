@@ -0,0 +1,88 @@
+package secretscmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/urfave/cli/v2"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+// Show prints secrets of the cluster
+func Show(c *cli.Context) error {
+	return withSecrets(c, func(name string, sc *secrets.Component) error {
+		fmt.Printf("== %s\n", name)
+		fmt.Printf("Gossip key:           %s\n", sc.GossipKey)
+		fmt.Printf("ACL bootstrap token:  %s\n", sc.BootstrapToken)
+		fmt.Printf("CA certificate:\n%s\n", sc.CACert)
+		fmt.Printf("CA key:\n%s\n", sc.CAKey)
+		return nil
+	})
+}
+
+// Export writes every secret into its own file, named like files
+// which consul and nomad CLI create
+func Export(c *cli.Context) error {
+	dir := c.String("dir")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return withSecrets(c, func(name string, sc *secrets.Component) error {
+		files := map[string]string{
+			fmt.Sprintf("%s-gossip.key", name):       sc.GossipKey,
+			fmt.Sprintf("%s-agent-ca.pem", name):     sc.CACert,
+			fmt.Sprintf("%s-agent-ca-key.pem", name): sc.CAKey,
+			fmt.Sprintf("%s-acl.token", name):        sc.BootstrapToken,
+		}
+		for file, content := range files {
+			if content == "" {
+				continue
+			}
+			path := filepath.Join(dir, file)
+			if err := os.WriteFile(path, []byte(content+"\n"), 0600); err != nil {
+				return err
+			}
+			log.Printf("Written %s\n", path)
+		}
+		return nil
+	})
+}
+
+// withSecrets runs action on secrets of selected components
+func withSecrets(c *cli.Context, action func(name string, sc *secrets.Component) error) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	st, err := state.Open(cfg.DCName)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	sec, err := secrets.Open(st)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range sec.Components {
+		if c.String("component") == "" || c.String("component") == name {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no secrets of cluster %s in %s", cfg.DCName, sec.Path())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := action(name, sec.Components[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,7 +4,9 @@ go 1.16
 
 require (
 	github.com/bramvdbogaerde/go-scp v1.0.0 // indirect
-	github.com/urfave/cli/v2 v2.3.0 // indirect
-	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/crypto v0.0.0-20210616213533-5ff15b29337e
+	golang.org/x/term v0.0.0-20201126162022-7de9c90e9dd1
+	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -1,14 +1,41 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/cmd"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
 )
 
 func main() {
-	if err := cmd.App.Run(os.Args); err != nil {
+	if ssh.Askpass() {
+		return
+	}
+
+	// interrupt cancels remote operations, so deferred cleanup
+	// like saving state and releasing lock still happens. The second
+	// one exits right away, which also aborts prompts and local work
+	// ignoring the context, saving state and releasing lock first.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		log.Println("Interrupted, cleaning up, interrupt again to exit immediately")
+		cancel()
+		<-interrupts
+		signal.Stop(interrupts)
+		log.Println("Interrupted again, saving state and exiting")
+		state.Abort()
+		os.Exit(130)
+	}()
+	if err := cmd.App.RunContext(ctx, os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
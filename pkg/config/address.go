@@ -0,0 +1,145 @@
+package config
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxExpanded limits number of addresses a range or CIDR expands to
+const maxExpanded = 1024
+
+var (
+	hostnamePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)(\.[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?)*\.?$`)
+	rangePattern    = regexp.MustCompile(`^(.*)\[(\d+)-(\d+)\](.*)$`)
+)
+
+// ExpandAddresses expands address expression into addresses. Expression
+// is hostname, IPv4 or IPv6 address, range like 10.0.1.[10-39] or
+// node[01-10].example.com, or CIDR like 10.0.1.0/28, whose network and
+// broadcast addresses are skipped.
+func ExpandAddresses(expr string) ([]string, error) {
+	expr = strings.TrimSpace(expr)
+	if match := rangePattern.FindStringSubmatch(expr); match != nil {
+		return expandRange(expr, match[1], match[2], match[3], match[4])
+	}
+	if strings.Contains(expr, "/") {
+		return expandCIDR(expr)
+	}
+	if err := ValidateAddress(expr); err != nil {
+		return nil, err
+	}
+	return []string{expr}, nil
+}
+
+// ValidateAddress checks that address is IP address or hostname
+func ValidateAddress(address string) error {
+	if net.ParseIP(address) != nil {
+		return nil
+	}
+	// 10.0.1.300 looks like hostname, but is mistyped address
+	if hostnamePattern.MatchString(address) && strings.Trim(address, "0123456789.") != "" {
+		return nil
+	}
+	return fmt.Errorf("%q is neither IP address nor hostname", address)
+}
+
+func expandRange(expr, prefix, from, to, suffix string) ([]string, error) {
+	first, err := strconv.Atoi(from)
+	if err != nil {
+		return nil, err
+	}
+	last, err := strconv.Atoi(to)
+	if err != nil {
+		return nil, err
+	}
+	if first > last {
+		return nil, fmt.Errorf("empty range in %q", expr)
+	}
+	if last-first >= maxExpanded {
+		return nil, fmt.Errorf("range %q has more than %d addresses", expr, maxExpanded)
+	}
+	// zero padded ranges like [01-10] keep their width
+	format := "%d"
+	if len(from) > 1 && strings.HasPrefix(from, "0") {
+		format = fmt.Sprintf("%%0%dd", len(from))
+	}
+
+	addresses := []string{}
+	for i := first; i <= last; i++ {
+		address := prefix + fmt.Sprintf(format, i) + suffix
+		if err := ValidateAddress(address); err != nil {
+			return nil, fmt.Errorf("range %q: %w", expr, err)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+func expandCIDR(expr string) ([]string, error) {
+	ip, network, err := net.ParseCIDR(expr)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("CIDR %q: only IPv4 networks can be expanded", expr)
+	}
+	ones, bits := network.Mask.Size()
+	// /0 has 2^32 addresses, which doesn't fit uint32
+	size := uint64(1) << uint(bits-ones)
+	first, last := uint64(0), size-1
+	if size > 2 {
+		first, last = 1, size-2
+	}
+	if last-first+1 > maxExpanded {
+		return nil, fmt.Errorf("CIDR %q has more than %d addresses", expr, maxExpanded)
+	}
+
+	base := binary.BigEndian.Uint32(network.IP.To4())
+	addresses := []string{}
+	for i := first; i <= last; i++ {
+		address := make(net.IP, 4)
+		binary.BigEndian.PutUint32(address, base+uint32(i))
+		addresses = append(addresses, address.String())
+	}
+	return addresses, nil
+}
+
+// Unreachable tries to connect to SSH port of every host and returns
+// errors of hosts which can't be connected. Hosts behind jump hosts
+// are skipped.
+func (c *Config) Unreachable(timeout time.Duration) []error {
+	hosts := c.AllHosts()
+	errs := make([]error, len(hosts))
+	wg := sync.WaitGroup{}
+	for i, host := range hosts {
+		if len(c.Jumps(host)) > 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, host Host) {
+			defer wg.Done()
+			address := net.JoinHostPort(host.Address, strconv.FormatInt(host.SshPort, 10))
+			conn, err := net.DialTimeout("tcp", address, timeout)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s is unreachable: %w", address, err)
+				return
+			}
+			conn.Close()
+		}(i, host)
+	}
+	wg.Wait()
+
+	unreachable := []error{}
+	for _, err := range errs {
+		if err != nil {
+			unreachable = append(unreachable, err)
+		}
+	}
+	return unreachable
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandAddresses(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    []string
+		wantErr bool
+	}{
+		{expr: "10.0.0.1", want: []string{"10.0.0.1"}},
+		{expr: " node1.example.com ", want: []string{"node1.example.com"}},
+		{expr: "fe80::1", want: []string{"fe80::1"}},
+		{expr: "10.0.1.[10-12]", want: []string{"10.0.1.10", "10.0.1.11", "10.0.1.12"}},
+		{expr: "node[08-10].example.com", want: []string{"node08.example.com", "node09.example.com", "node10.example.com"}},
+		{expr: "node[1-1]", want: []string{"node1"}},
+		{expr: "10.0.1.0/30", want: []string{"10.0.1.1", "10.0.1.2"}},
+		{expr: "10.0.1.5/31", want: []string{"10.0.1.4", "10.0.1.5"}},
+		{expr: "10.0.1.5/32", want: []string{"10.0.1.5"}},
+		{expr: "10.0.0.0/21", wantErr: true},
+		{expr: "10.0.0.0/0", wantErr: true},
+		{expr: "fe80::/120", wantErr: true},
+		{expr: "10.0.0.0/33", wantErr: true},
+		{expr: "10.0.1.[5-3]", wantErr: true},
+		{expr: "10.0.1.[250-260]", wantErr: true},
+		{expr: "node[0-99999999999]", wantErr: true},
+		{expr: "10.0.1.300", wantErr: true},
+		{expr: "bad_host", wantErr: true},
+		{expr: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ExpandAddresses(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ExpandAddresses(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExpandAddresses(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -1,23 +1,66 @@
 package config
 
 import (
+	"fmt"
 	"io/fs"
-	"io/ioutil"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
+// File is the config file in working directory
+const File = "consul.yaml"
+
 type Host struct {
-	Address   string `yaml:"address"`
-	SshPort   int64  `yaml:"sshPort"`
-	User      string `yaml:"user"`
+	Address string `yaml:"address"`
+	SshPort int64  `yaml:"sshPort"`
+	User    string `yaml:"user"`
+	// AgentName is node name of the agent, empty one is replaced
+	// by remote hostname before deploy
 	AgentName string `yaml:"agentName"`
-	Number    int    `yaml:"number"`
+	// JumpHosts override cluster-wide jump hosts for this host
+	JumpHosts []JumpHost `yaml:"jumpHosts,omitempty"`
+	// Become runs remote commands as root via BecomeMethod,
+	// which is sudo (default), su or doas
+	Become       bool   `yaml:"become,omitempty"`
+	BecomeMethod string `yaml:"becomeMethod,omitempty"`
+	// BecomePassword makes sudo or root password to be asked once per run,
+	// the password is never stored
+	BecomePassword bool `yaml:"becomePassword,omitempty"`
+	// SSHKey, SSHAgent and PasswordAuth override cluster-wide
+	// authentication settings for this host
+	SSHKey       string `yaml:"sshKey,omitempty"`
+	SSHAgent     bool   `yaml:"sshAgent,omitempty"`
+	PasswordAuth bool   `yaml:"passwordAuth,omitempty"`
+	// Labels are free-form, they are used by host selectors only
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// NodeClass and NodeMeta are rendered into nomad client config
+	NodeClass string            `yaml:"nodeClass,omitempty"`
+	NodeMeta  map[string]string `yaml:"nodeMeta,omitempty"`
+	// ConsulNodeMeta is rendered into node_meta of consul agent config
+	ConsulNodeMeta map[string]string `yaml:"consulNodeMeta,omitempty"`
+}
+
+// JumpHost is bastion host through which cluster hosts are reached.
+// Empty SSHKey means cluster-wide key.
+type JumpHost struct {
+	Address string `yaml:"address"`
+	SshPort int64  `yaml:"sshPort,omitempty"`
+	User    string `yaml:"user,omitempty"`
+	SSHKey  string `yaml:"sshKey,omitempty"`
 }
 
 type Config struct {
+	// SchemaVersion is the layout version of config file, older
+	// files are upgraded on load
+	SchemaVersion int    `yaml:"schemaVersion"`
 	BinaryVersion string `yaml:"version"`
 	GossipEnabled bool   `yaml:"gossipEnabled"`
 	ACLEnabled    bool   `yaml:"aclEnabled"`
@@ -26,36 +69,268 @@ type Config struct {
 	Clients       []Host `yaml:"clients"`
 	SSHKey        string `yaml:"sshKey"`
 	DCName        string `yaml:"dcName"`
+	// JumpHosts is chain of bastions, the first one is connected
+	// directly, the last one connects to cluster hosts
+	JumpHosts []JumpHost `yaml:"jumpHosts,omitempty"`
+	// SSHAgent makes ssh use keys loaded into ssh-agent instead of SSHKey
+	SSHAgent bool `yaml:"sshAgent,omitempty"`
+	// PasswordAuth makes ssh password to be asked once per run,
+	// the password is never stored
+	PasswordAuth bool `yaml:"passwordAuth,omitempty"`
+	// SSHConfig is ssh_config file, so its Host aliases can be used
+	// as host addresses
+	SSHConfig string   `yaml:"sshConfig,omitempty"`
+	Timeouts  Timeouts `yaml:"timeouts,omitempty"`
+	Retries   Retries  `yaml:"retries,omitempty"`
+	// Secrets given in config take precedence over generated ones
+	Secrets Secrets `yaml:"secrets,omitempty"`
+
+	// refs maps interpolated values back to their references
+	refs map[string]string
+}
+
+// Secrets of consul and nomad clusters. Values are usually references
+// like env:CONSUL_GOSSIP_KEY or file:./secrets/ca-key.pem, so config
+// can be committed without secrets.
+type Secrets struct {
+	Consul ComponentSecrets `yaml:"consul,omitempty"`
+	Nomad  ComponentSecrets `yaml:"nomad,omitempty"`
+}
+
+// ComponentSecrets replace secrets generated on deploy
+type ComponentSecrets struct {
+	GossipKey string `yaml:"gossipKey,omitempty"`
+	CACert    string `yaml:"caCert,omitempty"`
+	CAKey     string `yaml:"caKey,omitempty"`
+	// ACLToken is used instead of bootstrapping ACL system
+	ACLToken string `yaml:"aclToken,omitempty"`
+}
+
+// Timeouts limit remote operations, zero values mean defaults
+type Timeouts struct {
+	Connect time.Duration `yaml:"connect,omitempty"`
+	Command time.Duration `yaml:"command,omitempty"`
+	Upload  time.Duration `yaml:"upload,omitempty"`
 }
 
+// Retries configure how idempotent remote operations are retried
+// on transient failures, zero values mean defaults
+type Retries struct {
+	Attempts int `yaml:"attempts,omitempty"`
+	// Backoff is delay before the second attempt, it doubles
+	// with every next one
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+}
+
+// Save writes config file, keeping backup of the previous one.
+// Values resolved from references are written as references.
 func (c *Config) Save() error {
-	configBytes, err := yaml.Marshal(c)
+	withRefs, err := c.withRefs()
+	if err != nil {
+		return err
+	}
+	withRefs.SchemaVersion = SchemaVersion
+	configBytes, err := yaml.Marshal(withRefs)
 	if err != nil {
 		return err
 	}
-	if err = os.WriteFile("consul.yaml", configBytes, fs.FileMode(int(0664))); err != nil {
+	backupPath, err := Backup()
+	if err != nil {
+		return err
+	}
+	if backupPath != "" {
+		log.Printf("Previous config is backed up to %s\n", backupPath)
+	}
+	if err = os.WriteFile(File, configBytes, fs.FileMode(int(0664))); err != nil {
 		return err
 	}
-	log.Println("Config saved in consul.yaml!")
+	log.Printf("Config saved in %s!\n", File)
 	return nil
 }
 
 func Load() (*Config, error) {
 	var config Config
 
-	file, err := ioutil.ReadFile("consul.yaml")
+	file, err := readFile()
 	if err != nil {
 		return nil, err
 	}
 
-	err = yaml.Unmarshal(file, &config)
+	// unknown fields are rejected, so typos are not silently ignored
+	err = yaml.UnmarshalStrict(file, &config)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%s: %w", File, err)
+	}
+	if err := config.interpolate(); err != nil {
+		return nil, interpolationProblem(err)
 	}
 
 	return &config, nil
 }
 
+// AllHosts returns servers followed by clients
 func (c *Config) AllHosts() []Host {
-	return append(c.Servers, c.Clients...)
+	hosts := make([]Host, 0, len(c.Servers)+len(c.Clients))
+	hosts = append(hosts, c.Servers...)
+	return append(hosts, c.Clients...)
+}
+
+// Select returns hosts of the role, "server" or "client", or all
+// hosts when role is empty, which match the selector
+func (c *Config) Select(role, selector string) ([]Host, error) {
+	var hosts []Host
+	switch role {
+	case "":
+		hosts = c.AllHosts()
+	case "server":
+		hosts = c.Servers
+	case "client":
+		hosts = c.Clients
+	default:
+		return nil, fmt.Errorf("unknown role %q, expected server or client", role)
+	}
+	requirements, err := ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []Host{}
+	for _, host := range hosts {
+		if requirements.Matches(c.hostLabels(host)) {
+			selected = append(selected, host)
+		}
+	}
+	return selected, nil
+}
+
+// hostLabels returns labels of the host along with its role, node
+// class and agent name, which can be selected as well
+func (c *Config) hostLabels(host Host) map[string]string {
+	labels := map[string]string{}
+	for key, value := range host.Labels {
+		labels[key] = value
+	}
+	labels["role"] = c.Role(host)
+	labels["agentName"] = host.AgentName
+	if host.NodeClass != "" {
+		labels["nodeClass"] = host.NodeClass
+	}
+	return labels
+}
+
+// HCLAttributes renders map as sorted HCL attributes "key" = "value"
+func HCLAttributes(m map[string]string) []string {
+	attributes := []string{}
+	for key, value := range m {
+		attributes = append(attributes, fmt.Sprintf("%s = %s", strconv.Quote(key), strconv.Quote(value)))
+	}
+	sort.Strings(attributes)
+	return attributes
+}
+
+// DefaultAgentName returns first label of the address if it is a
+// hostname, otherwise empty name to be replaced by remote hostname
+func DefaultAgentName(address string) string {
+	if net.ParseIP(address) != nil {
+		return ""
+	}
+	return strings.SplitN(address, ".", 2)[0]
+}
+
+// Host returns host with the agent name or address
+func (c *Config) Host(name string) (Host, error) {
+	for _, host := range c.AllHosts() {
+		if host.AgentName == name || host.Address == name {
+			return host, nil
+		}
+	}
+	return Host{}, fmt.Errorf("host %s not found in config", name)
+}
+
+// Role returns "server" or "client" depending on which list
+// the host belongs to
+func (c *Config) Role(host Host) string {
+	for _, server := range c.Servers {
+		if server.AgentName == host.AgentName && server.Address == host.Address {
+			return "server"
+		}
+	}
+	return "client"
+}
+
+// Jumps returns chain of jump hosts used to reach the host
+func (c *Config) Jumps(host Host) []JumpHost {
+	if len(host.JumpHosts) > 0 {
+		return host.JumpHosts
+	}
+	return c.JumpHosts
+}
+
+// SSHKeyPath returns expanded path of private key used for the host
+func (c *Config) SSHKeyPath(host Host) string {
+	if host.SSHKey != "" {
+		return ExpandPath(host.SSHKey)
+	}
+	return ExpandPath(c.SSHKey)
+}
+
+// UseSSHAgent reports whether ssh-agent is used for the host
+func (c *Config) UseSSHAgent(host Host) bool {
+	return host.SSHAgent || (c.SSHAgent && host.SSHKey == "")
+}
+
+// UsePasswordAuth reports whether password is asked for the host
+func (c *Config) UsePasswordAuth(host Host) bool {
+	return host.PasswordAuth || c.PasswordAuth
+}
+
+// ExpandPath expands leading ~ and environment variables in path
+func ExpandPath(path string) string {
+	path = os.ExpandEnv(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+// ConnectTimeout returns timeout of establishing ssh connection
+func (c *Config) ConnectTimeout() time.Duration {
+	if c.Timeouts.Connect > 0 {
+		return c.Timeouts.Connect
+	}
+	return 30 * time.Second
+}
+
+// CommandTimeout returns timeout of single remote command
+func (c *Config) CommandTimeout() time.Duration {
+	if c.Timeouts.Command > 0 {
+		return c.Timeouts.Command
+	}
+	return 10 * time.Minute
+}
+
+// UploadTimeout returns timeout of single file transfer
+func (c *Config) UploadTimeout() time.Duration {
+	if c.Timeouts.Upload > 0 {
+		return c.Timeouts.Upload
+	}
+	return 10 * time.Minute
+}
+
+// RetryAttempts returns how many times idempotent operation is tried
+func (c *Config) RetryAttempts() int {
+	if c.Retries.Attempts > 0 {
+		return c.Retries.Attempts
+	}
+	return 3
+}
+
+// RetryBackoff returns delay before the second attempt
+func (c *Config) RetryBackoff() time.Duration {
+	if c.Retries.Backoff > 0 {
+		return c.Retries.Backoff
+	}
+	return 2 * time.Second
 }
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ErrNotSaved is returned when user declines saving edited config
+var ErrNotSaved = errors.New("config is not saved")
+
+// Edit walks through the survey with values of existing config as
+// defaults, letting user add, remove and edit hosts. Questions
+// answered in advance are not asked, hosts given in answers are added.
+// Summary of changes is shown and has to be confirmed. In non-interactive
+// mode nothing is asked, unanswered questions keep existing values.
+func Edit(existing *Config, a Answers) (*Config, error) {
+	c := existing.copy()
+	c.DCName = stringAnswer(a.DCName, a.NonInteractive, "Name of datacenter", c.DCName)
+	for _, host := range a.Servers {
+		if !c.hasHost(host) {
+			c.addHost(host, true)
+		}
+	}
+	for _, host := range a.Clients {
+		if !c.hasHost(host) {
+			c.addHost(host, false)
+		}
+	}
+	if !a.NonInteractive {
+		c.editHosts()
+	}
+
+	c.BinaryVersion = stringAnswer(a.BinaryVersion, a.NonInteractive, "Binary version", c.BinaryVersion)
+	c.GossipEnabled = boolAnswerDefault(a.GossipEnabled, a.NonInteractive, "Enable gossip encryption?", c.GossipEnabled)
+	c.TLSEnabled = boolAnswerDefault(a.TLSEnabled, a.NonInteractive, "Enable tls encryption?", c.TLSEnabled)
+	c.ACLEnabled = boolAnswerDefault(a.ACLEnabled, a.NonInteractive, "Enable acl?", c.ACLEnabled)
+	c.SSHKey = stringAnswer(a.SSHKey, a.NonInteractive, "Your private SSH key", c.SSHKey)
+
+	if err := c.checkReachability(a); err != nil {
+		return nil, err
+	}
+
+	diff, err := Diff(existing, c)
+	if err != nil {
+		return nil, err
+	}
+	if diff == "" {
+		fmt.Println("No changes")
+		return nil, ErrNotSaved
+	}
+	fmt.Println("Changes:")
+	fmt.Print(diff)
+	if !a.NonInteractive && !question("Save changes?", "yes", booleanInput).(bool) {
+		return nil, ErrNotSaved
+	}
+	return c, nil
+}
+
+func (c *Config) editHosts() {
+	for {
+		fmt.Println("Hosts:")
+		for _, host := range c.AllHosts() {
+			name := host.AgentName
+			if name == "" {
+				name = "(hostname)"
+			}
+			fmt.Printf("    %-12s %-8s %s@%s:%d\n", name, c.Role(host), host.User, host.Address, host.SshPort)
+		}
+		switch question("Hosts action (add/edit/remove/done)", "done", stringInput).(string) {
+		case "add":
+			c.surveyEntry(1)
+		case "edit":
+			name := question("Agent name or address of host to edit", "", stringInput).(string)
+			if !c.updateHost(name, editHost) {
+				fmt.Printf("Host %s not found\n", name)
+			}
+		case "remove":
+			name := question("Agent name or address of host to remove", "", stringInput).(string)
+			if !c.removeHost(name) {
+				fmt.Printf("Host %s not found\n", name)
+			}
+		case "done":
+			return
+		}
+	}
+}
+
+// editHost asks host settings with its current values as defaults
+func editHost(host Host) Host {
+	for {
+		host.Address = question("Address", host.Address, stringInput).(string)
+		err := ValidateAddress(host.Address)
+		if err == nil {
+			break
+		}
+		fmt.Println(err)
+	}
+	host.AgentName = question("Agent name (empty for remote hostname)", host.AgentName, stringInput).(string)
+	host.SshPort = question("SSH port", strconv.FormatInt(host.SshPort, 10), intInput).(int64)
+	host.User = question("Remote user", host.User, stringInput).(string)
+	host.Become = false
+	host.BecomePassword = false
+	if host.User != "root" {
+		host.Become = question("Use sudo?", "yes", booleanInput).(bool)
+		if host.Become {
+			host.BecomePassword = question("Does sudo require password?", "no", booleanInput).(bool)
+		}
+	}
+	return host
+}
+
+// hasHost reports whether host with the same address and SSH port
+// is already in config, so repeated runs don't duplicate hosts
+func (c *Config) hasHost(host Host) bool {
+	for _, h := range c.AllHosts() {
+		if h.Address == host.Address && h.SshPort == host.SshPort {
+			return true
+		}
+	}
+	return false
+}
+
+// updateHost replaces host with the agent name or address by result
+// of update
+func (c *Config) updateHost(name string, update func(Host) Host) bool {
+	for _, hosts := range [][]Host{c.Servers, c.Clients} {
+		for i := range hosts {
+			if hosts[i].AgentName == name || hosts[i].Address == name {
+				hosts[i] = update(hosts[i])
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeHost removes host with the agent name or address
+func (c *Config) removeHost(name string) bool {
+	for _, hosts := range []*[]Host{&c.Servers, &c.Clients} {
+		for i := range *hosts {
+			if (*hosts)[i].AgentName == name || (*hosts)[i].Address == name {
+				*hosts = append((*hosts)[:i], (*hosts)[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copy returns deep copy of config, so editing it doesn't touch original
+func (c *Config) copy() *Config {
+	copied := *c
+	copied.Servers = append([]Host{}, c.Servers...)
+	copied.Clients = append([]Host{}, c.Clients...)
+	copied.JumpHosts = append([]JumpHost{}, c.JumpHosts...)
+	return &copied
+}
+
+func stringAnswer(answer string, nonInteractive bool, q, defaultValue string) string {
+	if answer != "" {
+		return answer
+	}
+	if nonInteractive {
+		return defaultValue
+	}
+	return question(q, defaultValue, stringInput).(string)
+}
+
+func boolAnswerDefault(answer *bool, nonInteractive bool, q string, defaultValue bool) bool {
+	if answer != nil {
+		return *answer
+	}
+	if nonInteractive {
+		return defaultValue
+	}
+	if defaultValue {
+		return question(q, "yes", booleanInput).(bool)
+	}
+	return question(q, "no", booleanInput).(bool)
+}
+
+// Diff returns lines of YAML which differ between configs, removed
+// lines are prefixed with "-" and added ones with "+"
+func Diff(old, new *Config) (string, error) {
+	oldYaml, err := yaml.Marshal(old)
+	if err != nil {
+		return "", err
+	}
+	newYaml, err := yaml.Marshal(new)
+	if err != nil {
+		return "", err
+	}
+	a := strings.Split(strings.TrimSuffix(string(oldYaml), "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(string(newYaml), "\n"), "\n")
+
+	// lcs[i][j] is length of longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := strings.Builder{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			fmt.Fprintf(&diff, "+ %s\n", b[j])
+			j++
+		default:
+			fmt.Fprintf(&diff, "- %s\n", a[i])
+			i++
+		}
+	}
+	return diff.String(), nil
+}
+
+// Backup copies config file aside with timestamp suffix and returns
+// path of the copy, or empty path when there is no config file yet
+func Backup() (string, error) {
+	data, err := ioutil.ReadFile(File)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	stamp := time.Now().Format("20060102-150405")
+	backupPath := fmt.Sprintf("%s.%s.bak", File, stamp)
+	// several saves within a second don't overwrite each other's backups
+	for i := 1; ; i++ {
+		file, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+		if errors.Is(err, os.ErrExist) {
+			backupPath = fmt.Sprintf("%s.%s-%d.bak", File, stamp, i)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		if _, err := file.Write(data); err != nil {
+			return "", err
+		}
+		return backupPath, file.Close()
+	}
+}
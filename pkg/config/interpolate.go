@@ -0,0 +1,208 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	yamlnode "gopkg.in/yaml.v3"
+)
+
+// envVariable matches ${NAME} references in config values
+var envVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// secretFields may hold file: and env: references besides ${NAME}
+var secretFields = map[string]bool{
+	"gossipKey": true,
+	"caCert":    true,
+	"caKey":     true,
+	"aclToken":  true,
+}
+
+// pathFields may hold env: references besides ${NAME}
+var pathFields = map[string]bool{
+	"sshKey":    true,
+	"sshConfig": true,
+}
+
+// interpolationError is failure to resolve value of the field at path
+// of mapping keys and sequence indices in config file
+type interpolationError struct {
+	path  []interface{}
+	field string
+	err   error
+}
+
+func (e *interpolationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.field, e.err)
+}
+
+func (e *interpolationError) Unwrap() error {
+	return e.err
+}
+
+// interpolate replaces ${NAME} in all values with environment variables
+// and resolves file:path and env:NAME references of secrets and
+// env:NAME references of paths. Original values are remembered, so
+// Save writes references back instead of resolved secrets.
+func (c *Config) interpolate() error {
+	c.refs = map[string]string{}
+	return walkStrings(reflect.ValueOf(c).Elem(), nil, "", func(path []interface{}, field, value string) (string, error) {
+		resolved, err := resolve(field, value)
+		if err != nil {
+			return "", &interpolationError{path: path, field: field, err: err}
+		}
+		if resolved != value {
+			c.refs[refKey(field, resolved)] = value
+		}
+		return resolved, nil
+	})
+}
+
+// interpolationProblem prefixes interpolation error with config file
+// and line of the value which can't be resolved
+func interpolationProblem(err error) error {
+	var interpolationErr *interpolationError
+	if !errors.As(err, &interpolationErr) {
+		return fmt.Errorf("%s: %w", File, err)
+	}
+	// lines are looked up in the file as it is, not as it is migrated
+	data, readErr := ioutil.ReadFile(File)
+	var root yamlnode.Node
+	if readErr != nil || yamlnode.Unmarshal(data, &root) != nil {
+		return fmt.Errorf("%s: %w", File, err)
+	}
+	return fmt.Errorf("%s:%d: %w", File, nodeLine(&root, interpolationErr.path...), err)
+}
+
+// withRefs returns copy of config with resolved values replaced by
+// the references they came from
+func (c *Config) withRefs() (*Config, error) {
+	copied := c.copy()
+	copied.Servers = copyHosts(c.Servers)
+	copied.Clients = copyHosts(c.Clients)
+	err := walkStrings(reflect.ValueOf(copied).Elem(), nil, "", func(path []interface{}, field, value string) (string, error) {
+		if ref, ok := c.refs[refKey(field, value)]; ok {
+			return ref, nil
+		}
+		return value, nil
+	})
+	return copied, err
+}
+
+func refKey(field, value string) string {
+	return field + "\x00" + value
+}
+
+func resolve(field, value string) (string, error) {
+	var missing []string
+	value = envVariable.ReplaceAllStringFunc(value, func(ref string) string {
+		name := envVariable.FindStringSubmatch(ref)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return env
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	switch {
+	case (secretFields[field] || pathFields[field]) && strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return env, nil
+	case secretFields[field] && strings.HasPrefix(value, "file:"):
+		path := ExpandPath(strings.TrimPrefix(value, "file:"))
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("can't read secret: %w", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// walkStrings replaces every string reachable from v with result of
+// fn, called with path of the string in config file and yaml name of
+// the field holding it
+func walkStrings(v reflect.Value, path []interface{}, field string, fn func(path []interface{}, field, value string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		value, err := fn(path, field, v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(value)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return walkStrings(v.Elem(), path, field, fn)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			tag := v.Type().Field(i).Tag.Get("yaml")
+			name := strings.Split(tag, ",")[0]
+			if name == "" || name == "-" || !v.Field(i).CanSet() {
+				continue
+			}
+			if err := walkStrings(v.Field(i), appendPath(path, name), name, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), appendPath(path, i), field, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for _, key := range v.MapKeys() {
+			value, err := fn(appendPath(path, key.String()), field+"."+key.String(), v.MapIndex(key).String())
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(key, reflect.ValueOf(value).Convert(v.Type().Elem()))
+		}
+	}
+	return nil
+}
+
+// appendPath returns copy of path with element appended
+func appendPath(path []interface{}, element interface{}) []interface{} {
+	return append(append([]interface{}{}, path...), element)
+}
+
+// copyHosts copies hosts along with their slices and maps
+func copyHosts(hosts []Host) []Host {
+	copied := []Host{}
+	for _, host := range hosts {
+		host.JumpHosts = append([]JumpHost{}, host.JumpHosts...)
+		host.Labels = copyMap(host.Labels)
+		host.NodeMeta = copyMap(host.NodeMeta)
+		host.ConsulNodeMeta = copyMap(host.ConsulNodeMeta)
+		copied = append(copied, host)
+	}
+	return copied
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := map[string]string{}
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const refsConfig = `schemaVersion: 2
+dcName: ${TEST_DC}-east
+version: 1.10.0
+servers:
+- address: 10.0.0.1
+  sshPort: 22
+  user: ${TEST_USER}
+  agentName: server1
+  sshKey: env:TEST_KEY_PATH
+secrets:
+  consul:
+    gossipKey: file:gossip.key
+    aclToken: env:TEST_TOKEN
+`
+
+// inTempDir runs test in empty working directory with environment
+// variables set
+func inTempDir(t *testing.T, env map[string]string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+	}
+	t.Cleanup(func() {
+		for name := range env {
+			os.Unsetenv(name)
+		}
+		os.Chdir(wd)
+	})
+}
+
+func TestInterpolate(t *testing.T) {
+	inTempDir(t, map[string]string{
+		"TEST_DC":       "dc1",
+		"TEST_USER":     "ops",
+		"TEST_KEY_PATH": "/keys/id_rsa",
+		"TEST_TOKEN":    "acl-token",
+	})
+	if err := ioutil.WriteFile("gossip.key", []byte("gossip-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(File, []byte(refsConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := []string{c.DCName, c.Servers[0].User, c.Servers[0].SSHKey, c.Secrets.Consul.GossipKey, c.Secrets.Consul.ACLToken}
+	expected := []string{"dc1-east", "ops", "/keys/id_rsa", "gossip-secret", "acl-token"}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("resolved %v, expected %v", resolved, expected)
+	}
+
+	// references are written back instead of resolved values
+	c.Clients = append(c.Clients, Host{Address: "10.0.1.1", SshPort: 22, User: "ops"})
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"${TEST_DC}-east", "${TEST_USER}", "env:TEST_KEY_PATH", "file:gossip.key", "env:TEST_TOKEN"} {
+		if !strings.Contains(string(saved), ref) {
+			t.Errorf("saved config has no %s:\n%s", ref, saved)
+		}
+	}
+	for _, secret := range []string{"gossip-secret", "acl-token"} {
+		if strings.Contains(string(saved), secret) {
+			t.Errorf("saved config has resolved secret %s:\n%s", secret, saved)
+		}
+	}
+}
+
+func TestInterpolateMissingVariable(t *testing.T) {
+	inTempDir(t, map[string]string{"TEST_DC": "dc1", "TEST_KEY_PATH": "/keys/id_rsa", "TEST_TOKEN": "acl-token"})
+	if err := ioutil.WriteFile("gossip.key", []byte("gossip-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(File, []byte(refsConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Load()
+	if err == nil || err.Error() != "consul.yaml:7: user: environment variable TEST_USER is not set" {
+		t.Errorf("load error: %v", err)
+	}
+	problems := validate([]byte(refsConfig))
+	want := []Problem{{Line: 7, Message: "user: environment variable TEST_USER is not set"}}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems = %+v, want %+v", problems, want)
+	}
+
+	os.Setenv("TEST_USER", "ops")
+	os.Unsetenv("TEST_TOKEN")
+	_, err = Load()
+	if err == nil || err.Error() != "consul.yaml:13: aclToken: environment variable TEST_TOKEN is not set" {
+		t.Errorf("load error: %v", err)
+	}
+	os.Unsetenv("TEST_USER")
+}
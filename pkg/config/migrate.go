@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SchemaVersion is the version of config file layout written by this
+// binary. Files without schemaVersion are of version 1.
+const SchemaVersion = 2
+
+// migration upgrades raw config to the next version. It works on yaml
+// document rather than Config, so fields removed from Config can still
+// be read and converted.
+type migration struct {
+	upgrade func(doc yaml.MapSlice) (yaml.MapSlice, error)
+	// removed are fields dropped by the upgrade as type.field, which
+	// strict unmarshalling of older files reports as unknown
+	removed []string
+}
+
+// migrations upgrade config of version i+1 to version i+2
+var migrations = []migration{
+	{upgrade: dropHostNumbers, removed: []string{"config.Host.number"}},
+}
+
+// unknownField matches yaml error about field missing in Config
+var unknownField = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+
+// removedField reports whether message of strict unmarshalling is
+// about field which file of the version may have, as it is removed
+// by its migrations
+func removedField(version int, message string) bool {
+	match := unknownField.FindStringSubmatch(message)
+	if match == nil || version >= SchemaVersion {
+		return false
+	}
+	for _, m := range migrations[version-1:] {
+		for _, field := range m.removed {
+			if field == match[2]+"."+match[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dropHostNumbers removes number of servers and clients, which
+// is not used since agents are named explicitly
+func dropHostNumbers(doc yaml.MapSlice) (yaml.MapSlice, error) {
+	for i, item := range doc {
+		if item.Key != "servers" && item.Key != "clients" {
+			continue
+		}
+		hosts, ok := item.Value.([]interface{})
+		if !ok {
+			continue
+		}
+		for j, host := range hosts {
+			if fields, ok := host.(yaml.MapSlice); ok {
+				hosts[j] = without(fields, "number")
+			}
+		}
+		doc[i].Value = hosts
+	}
+	return doc, nil
+}
+
+// without returns yaml mapping without the key
+func without(fields yaml.MapSlice, key string) yaml.MapSlice {
+	result := yaml.MapSlice{}
+	for _, field := range fields {
+		if field.Key != key {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// migrate upgrades config file content to SchemaVersion, returning
+// the version it had. Up to date content is returned as is.
+func migrate(data []byte) ([]byte, int, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+	version := 1
+	for _, item := range doc {
+		if item.Key != "schemaVersion" {
+			continue
+		}
+		v, ok := item.Value.(int)
+		if !ok || v < 1 {
+			return nil, 0, fmt.Errorf("invalid schemaVersion %v", item.Value)
+		}
+		version = v
+	}
+	if version > SchemaVersion {
+		return nil, version, fmt.Errorf("schemaVersion %d is newer than %d supported by this nomad-deploy, upgrade nomad-deploy",
+			version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return data, version, nil
+	}
+
+	var err error
+	for _, m := range migrations[version-1:] {
+		if doc, err = m.upgrade(doc); err != nil {
+			return nil, version, err
+		}
+	}
+	doc = without(doc, "schemaVersion")
+	doc = append(yaml.MapSlice{{Key: "schemaVersion", Value: SchemaVersion}}, doc...)
+	migrated, err := yaml.Marshal(doc)
+	return migrated, version, err
+}
+
+// readFile reads config file upgraded to SchemaVersion
+func readFile() ([]byte, error) {
+	data, err := ioutil.ReadFile(File)
+	if err != nil {
+		return nil, err
+	}
+	migrated, version, err := migrate(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", File, err)
+	}
+	if version < SchemaVersion {
+		log.Printf("%s has schema version %d, it is upgraded to %d in memory, run `config migrate` to save it\n",
+			File, version, SchemaVersion)
+	}
+	return migrated, nil
+}
+
+// Migrate upgrades config file to SchemaVersion in place, keeping
+// the previous file as a backup. It returns false if the file is
+// already up to date.
+func Migrate() (bool, error) {
+	data, err := ioutil.ReadFile(File)
+	if err != nil {
+		return false, err
+	}
+	migrated, version, err := migrate(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", File, err)
+	}
+	if version == SchemaVersion {
+		return false, nil
+	}
+	backupPath, err := Backup()
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Previous config is backed up to %s\n", backupPath)
+	if err := os.WriteFile(File, migrated, 0664); err != nil {
+		return false, err
+	}
+	log.Printf("%s is upgraded from schema version %d to %d\n", File, version, SchemaVersion)
+	return true, nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const v1Config = `dcName: dc1
+version: 1.10.0
+servers:
+- address: 10.0.0.1
+  sshPort: 22
+  user: root
+  agentName: s1
+  number: 1
+`
+
+func TestMigrate(t *testing.T) {
+	migrated, version, err := migrate([]byte(v1Config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 {
+		t.Errorf("version = %d, want 1", version)
+	}
+	if !strings.HasPrefix(string(migrated), "schemaVersion: 2\n") || strings.Contains(string(migrated), "number") {
+		t.Errorf("migrated config:\n%s", migrated)
+	}
+
+	current, version, err := migrate(migrated)
+	if err != nil || version != SchemaVersion || string(current) != string(migrated) {
+		t.Errorf("up to date config is changed: %d %v\n%s", version, err, current)
+	}
+
+	if _, _, err := migrate([]byte("schemaVersion: 99\n")); err == nil {
+		t.Error("config newer than supported is accepted")
+	}
+}
+
+func TestValidateLinesOfOldConfig(t *testing.T) {
+	problems := validate([]byte(v1Config + "tlsEnable: true\n"))
+	want := []Problem{{Line: 9, Message: "field tlsEnable not found in type config.Config"}}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems = %+v, want %+v", problems, want)
+	}
+
+	problems = validate([]byte("schemaVersion: 2\n" + v1Config))
+	want = []Problem{{Line: 9, Message: "field number not found in type config.Host"}}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("problems = %+v, want %+v", problems, want)
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// requirement is a single condition of selector
+type requirement struct {
+	key   string
+	value string
+	op    string
+}
+
+// Selector selects hosts by labels. It is a comma separated list of
+// conditions key=value, key!=value, key (label exists) and !key
+// (label doesn't exist), all of which must hold.
+type Selector []requirement
+
+// ParseSelector parses selector, empty one matches all hosts
+func ParseSelector(s string) (Selector, error) {
+	selector := Selector{}
+	for _, condition := range strings.Split(s, ",") {
+		condition = strings.TrimSpace(condition)
+		switch {
+		case condition == "":
+			continue
+		case strings.Contains(condition, "!="):
+			parts := strings.SplitN(condition, "!=", 2)
+			selector = append(selector, requirement{key: strings.TrimSpace(parts[0]), value: strings.TrimSpace(parts[1]), op: "!="})
+		case strings.Contains(condition, "="):
+			parts := strings.SplitN(condition, "=", 2)
+			selector = append(selector, requirement{key: strings.TrimSpace(parts[0]), value: strings.TrimSpace(parts[1]), op: "="})
+		case strings.HasPrefix(condition, "!"):
+			selector = append(selector, requirement{key: strings.TrimSpace(condition[1:]), op: "!"})
+		default:
+			selector = append(selector, requirement{key: condition, op: ""})
+		}
+		if selector[len(selector)-1].key == "" {
+			return nil, fmt.Errorf("invalid selector condition %q", condition)
+		}
+	}
+	return selector, nil
+}
+
+// Matches tells whether labels satisfy all conditions of selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		value, ok := labels[r.key]
+		switch r.op {
+		case "=":
+			if !ok || value != r.value {
+				return false
+			}
+		case "!=":
+			if ok && value == r.value {
+				return false
+			}
+		case "!":
+			if ok {
+				return false
+			}
+		default:
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelect(t *testing.T) {
+	c := &Config{
+		Servers: []Host{
+			{Address: "10.0.0.1", AgentName: "server1", Labels: map[string]string{"zone": "a"}},
+			{Address: "10.0.0.2", AgentName: "server2", Labels: map[string]string{"zone": "b"}},
+		},
+		Clients: []Host{
+			{Address: "10.0.1.1", AgentName: "client1", NodeClass: "gpu", Labels: map[string]string{"zone": "a", "ssd": "true"}},
+			{Address: "10.0.1.2", AgentName: "client2"},
+		},
+	}
+	tests := []struct {
+		role     string
+		selector string
+		names    []string
+		err      bool
+	}{
+		{"", "", []string{"server1", "server2", "client1", "client2"}, false},
+		{"server", "", []string{"server1", "server2"}, false},
+		{"client", "", []string{"client1", "client2"}, false},
+		{"", "role=client", []string{"client1", "client2"}, false},
+		{"", "role!=client", []string{"server1", "server2"}, false},
+		{"", "zone=a", []string{"server1", "client1"}, false},
+		{"", "zone!=a", []string{"server2", "client2"}, false},
+		{"client", "zone = a , ssd", []string{"client1"}, false},
+		{"", "ssd", []string{"client1"}, false},
+		{"", "!zone", []string{"client2"}, false},
+		{"", "agentName=server2", []string{"server2"}, false},
+		{"", "nodeClass=gpu", []string{"client1"}, false},
+		{"server", "nodeClass=gpu", []string{}, false},
+		{"", "=a", nil, true},
+		{"", "!", nil, true},
+		{"", "zone=a,!=b", nil, true},
+		{"agent", "", nil, true},
+	}
+	for _, test := range tests {
+		hosts, err := c.Select(test.role, test.selector)
+		if (err != nil) != test.err {
+			t.Errorf("role %q selector %q: error %v", test.role, test.selector, err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		names := []string{}
+		for _, host := range hosts {
+			names = append(names, host.AgentName)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("role %q selector %q: selected %v, expected %v", test.role, test.selector, names, test.names)
+		}
+	}
+}
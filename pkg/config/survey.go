@@ -6,6 +6,7 @@ import (
 	"log"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -15,29 +16,230 @@ const (
 	hostInput    = iota
 )
 
-func Survey() *Config {
+// Answers are survey answers given in advance, questions answered
+// here are not asked. Nil booleans and empty strings are unanswered.
+type Answers struct {
+	DCName        string
+	Servers       []Host
+	Clients       []Host
+	BinaryVersion string
+	GossipEnabled *bool
+	TLSEnabled    *bool
+	ACLEnabled    *bool
+	SSHKey        string
+	// CheckReachability makes survey check SSH ports of hosts
+	// before returning config
+	CheckReachability *bool
+	// NonInteractive makes survey fail on missing required answers
+	// and use defaults for the rest instead of asking
+	NonInteractive bool
+}
+
+func Survey(a Answers) (*Config, error) {
+	if a.NonInteractive {
+		missing := []string{}
+		if a.DCName == "" {
+			missing = append(missing, "datacenter name")
+		}
+		if len(a.Servers) == 0 {
+			missing = append(missing, "servers")
+		}
+		if a.BinaryVersion == "" {
+			missing = append(missing, "binary version")
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("missing required answers: %s", strings.Join(missing, ", "))
+		}
+	}
+
 	c := new(Config)
-	c.DCName = question("Name of datacenter", "dc1", stringInput).(string)
-	hostsNumber := question("Number of hosts", "1", intInput).(int64)
-	for hostNumber := int64(1); hostNumber <= hostsNumber; hostNumber++ {
-		address := question(fmt.Sprintf("IP of %d host", hostNumber), "127.0.0.1", hostInput).(string)
-		sshPort := question(fmt.Sprintf("SSH port of %d host", hostNumber), "22", intInput).(int64)
-		user := question(fmt.Sprintf("Remote user for %d host", hostNumber), "root", stringInput).(string)
-		isServer := question(fmt.Sprintf("Is %d host server?", hostNumber), "yes", booleanInput).(bool)
-
-		if isServer {
-			c.Servers = append(c.Servers, Host{address, sshPort, user, fmt.Sprintf("server-%d", len(c.Servers)), len(c.Servers)})
-		} else {
-			c.Clients = append(c.Clients, Host{address, sshPort, user, fmt.Sprintf("client-%d", len(c.Clients)), len(c.Clients)})
-		}
-	}
-	c.BinaryVersion = question("Binary version", "1.10.0", stringInput).(string)
-	c.GossipEnabled = question("Enable gossip encryption?", "yes", booleanInput).(bool)
-	c.TLSEnabled = question("Enable tls encryption?", "yes", booleanInput).(bool)
-	c.ACLEnabled = question("Enable acl?", "yes", booleanInput).(bool)
-	c.SSHKey = question("Your private SSH key", "~/.ssh/id_rsa", stringInput).(string)
-
-	return c
+	c.DCName = a.DCName
+	if c.DCName == "" {
+		c.DCName = question("Name of datacenter", "dc1", stringInput).(string)
+	}
+	if len(a.Servers) > 0 || len(a.Clients) > 0 {
+		for _, host := range a.Servers {
+			c.addHost(host, true)
+		}
+		for _, host := range a.Clients {
+			c.addHost(host, false)
+		}
+	} else {
+		c.surveyHosts()
+	}
+
+	c.BinaryVersion = a.BinaryVersion
+	if c.BinaryVersion == "" {
+		c.BinaryVersion = question("Binary version", "1.10.0", stringInput).(string)
+	}
+	c.GossipEnabled = boolAnswer(a.GossipEnabled, a.NonInteractive, "Enable gossip encryption?")
+	c.TLSEnabled = boolAnswer(a.TLSEnabled, a.NonInteractive, "Enable tls encryption?")
+	c.ACLEnabled = boolAnswer(a.ACLEnabled, a.NonInteractive, "Enable acl?")
+	c.SSHKey = a.SSHKey
+	if c.SSHKey == "" && a.NonInteractive {
+		c.SSHKey = "~/.ssh/id_rsa"
+	} else if c.SSHKey == "" {
+		c.SSHKey = question("Your private SSH key", "~/.ssh/id_rsa", stringInput).(string)
+	}
+
+	if err := c.checkReachability(a); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// checkReachability checks SSH ports of hosts if asked to, letting
+// user save config with unreachable hosts in interactive mode
+func (c *Config) checkReachability(a Answers) error {
+	check := a.CheckReachability != nil && *a.CheckReachability
+	if a.CheckReachability == nil && !a.NonInteractive {
+		check = question("Check that SSH ports of hosts are reachable?", "no", booleanInput).(bool)
+	}
+	if !check {
+		return nil
+	}
+	unreachable := c.Unreachable(5 * time.Second)
+	for _, err := range unreachable {
+		log.Println(err)
+	}
+	if len(unreachable) > 0 && (a.NonInteractive || !Confirm("Save config anyway?")) {
+		return fmt.Errorf("%d host(s) are unreachable", len(unreachable))
+	}
+	return nil
+}
+
+func (c *Config) surveyHosts() {
+	entriesNumber := question("Number of host entries (address, range or CIDR each)", "1", intInput).(int64)
+	for entry := int64(1); entry <= entriesNumber; entry++ {
+		c.surveyEntry(entry)
+	}
+}
+
+// surveyEntry asks about address, range or CIDR of hosts and adds
+// them to config
+func (c *Config) surveyEntry(entry int64) {
+	expr := question(fmt.Sprintf("Address, range like 10.0.1.[10-39] or CIDR of %d entry", entry), "127.0.0.1", hostInput).(string)
+	addresses, _ := ExpandAddresses(expr)
+	sshPort := question(fmt.Sprintf("SSH port of %d entry", entry), "22", intInput).(int64)
+	user := question(fmt.Sprintf("Remote user for %d entry", entry), "root", stringInput).(string)
+
+	servers := int64(0)
+	if len(addresses) == 1 {
+		if question(fmt.Sprintf("Is %s server?", addresses[0]), "yes", booleanInput).(bool) {
+			servers = 1
+		}
+	} else {
+		defaultServers := 0
+		if len(c.Servers) == 0 {
+			defaultServers = 3
+			if len(addresses) < 3 {
+				defaultServers = 1
+			}
+		}
+		for {
+			servers = question(fmt.Sprintf("How many of %d hosts are servers (first ones)?", len(addresses)),
+				strconv.Itoa(defaultServers), intInput).(int64)
+			if servers >= 0 && servers <= int64(len(addresses)) {
+				break
+			}
+		}
+	}
+
+	host := Host{SshPort: sshPort, User: user}
+	if user != "root" {
+		host.Become = question(fmt.Sprintf("Use sudo on %d entry?", entry), "yes", booleanInput).(bool)
+		if host.Become {
+			host.BecomePassword = question("Does sudo require password?", "no", booleanInput).(bool)
+		}
+	}
+	for i, address := range addresses {
+		host.Address = address
+		host.AgentName = ""
+		if len(addresses) == 1 {
+			host.AgentName = question(fmt.Sprintf("Agent name of %s (empty for remote hostname)", address),
+				DefaultAgentName(address), stringInput).(string)
+		}
+		c.addHost(host, int64(i) < servers)
+	}
+}
+
+// addHost appends host to servers or clients. Host without agent name
+// is named after its address if it is a hostname not taken yet.
+func (c *Config) addHost(host Host, isServer bool) {
+	if host.AgentName == "" {
+		host.AgentName = DefaultAgentName(host.Address)
+		for _, h := range c.AllHosts() {
+			if h.AgentName == host.AgentName {
+				host.AgentName = ""
+			}
+		}
+	}
+	if isServer {
+		c.Servers = append(c.Servers, host)
+	} else {
+		c.Clients = append(c.Clients, host)
+	}
+}
+
+// boolAnswer returns given answer, asks the question when there is
+// none, or defaults to false in non-interactive mode
+func boolAnswer(answer *bool, nonInteractive bool, q string) bool {
+	if answer != nil {
+		return *answer
+	}
+	if nonInteractive {
+		return false
+	}
+	return question(q, "yes", booleanInput).(bool)
+}
+
+// ParseHosts parses hosts given as address[:port][@user], where address
+// can be a range or CIDR expanded by ExpandAddresses. Port defaults to
+// 22 and user to root, non-root users get sudo.
+func ParseHosts(spec string) ([]Host, error) {
+	host := Host{SshPort: 22, User: "root"}
+	expr := spec
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		expr, host.User = spec[:i], spec[i+1:]
+		if host.User == "" {
+			return nil, fmt.Errorf("empty user in host %q", spec)
+		}
+	}
+	// port follows bracketed IPv6 address or the only colon
+	port := ""
+	switch {
+	case strings.HasPrefix(expr, "[") && strings.Contains(expr, ":"):
+		i := strings.LastIndex(expr, "]")
+		if i < 0 || i+1 < len(expr) && expr[i+1] != ':' {
+			return nil, fmt.Errorf("invalid host %q", spec)
+		}
+		if i+1 < len(expr) {
+			port = expr[i+2:]
+		}
+		expr = expr[1:i]
+	case strings.Count(expr, ":") == 1:
+		i := strings.Index(expr, ":")
+		expr, port = expr[:i], expr[i+1:]
+	}
+	if port != "" {
+		var err error
+		host.SshPort, err = strconv.ParseInt(port, 10, 64)
+		if err != nil || host.SshPort < 1 || host.SshPort > 65535 {
+			return nil, fmt.Errorf("invalid port in host %q", spec)
+		}
+	}
+	addresses, err := ExpandAddresses(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host %q: %w", spec, err)
+	}
+	host.Become = host.User != "root"
+
+	hosts := []Host{}
+	for _, address := range addresses {
+		host.Address = address
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
 }
 
 func question(q string, defaultValue string, t int) interface{} {
@@ -114,7 +316,6 @@ func question(q string, defaultValue string, t int) interface{} {
 			printQuestion()
 		}
 	case hostInput:
-	QustionLoop:
 		for {
 			var s string
 			fmt.Scanln(&s)
@@ -122,29 +323,19 @@ func question(q string, defaultValue string, t int) interface{} {
 			if s == "" {
 				return defaultValue
 			}
-
-			octetStrings := strings.Split(s, ".")
-			if len(octetStrings) != 4 {
+			if _, err := ExpandAddresses(s); err != nil {
+				fmt.Println(err)
 				printQuestion()
 				continue
 			}
-
-			for _, octet := range octetStrings {
-				octetNumber, err := strconv.ParseInt(octet, 0, 64)
-
-				if err != nil {
-					printQuestion()
-					continue QustionLoop
-				}
-
-				if octetNumber < 0 || octetNumber > 255 {
-					printQuestion()
-					continue QustionLoop
-				}
-			}
 			return s
 		}
 	}
 
 	return nil
 }
+
+// Confirm asks yes/no question defaulting to no
+func Confirm(q string) bool {
+	return question(q, "no", booleanInput).(bool)
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []Host
+		wantErr bool
+	}{
+		{
+			spec: "10.0.0.1",
+			want: []Host{{Address: "10.0.0.1", SshPort: 22, User: "root"}},
+		},
+		{
+			spec: "10.0.0.2:2222@ubuntu",
+			want: []Host{{Address: "10.0.0.2", SshPort: 2222, User: "ubuntu", Become: true}},
+		},
+		{
+			spec: "node1.example.com@ops",
+			want: []Host{{Address: "node1.example.com", SshPort: 22, User: "ops", Become: true}},
+		},
+		{
+			spec: "[fe80::1]:2222",
+			want: []Host{{Address: "fe80::1", SshPort: 2222, User: "root"}},
+		},
+		{
+			spec: "[fe80::1]",
+			want: []Host{{Address: "fe80::1", SshPort: 22, User: "root"}},
+		},
+		{
+			spec: "fe80::1",
+			want: []Host{{Address: "fe80::1", SshPort: 22, User: "root"}},
+		},
+		{
+			spec: "10.0.1.[1-2]:2200",
+			want: []Host{
+				{Address: "10.0.1.1", SshPort: 2200, User: "root"},
+				{Address: "10.0.1.2", SshPort: 2200, User: "root"},
+			},
+		},
+		{
+			spec: "10.0.1.0/30@ops",
+			want: []Host{
+				{Address: "10.0.1.1", SshPort: 22, User: "ops", Become: true},
+				{Address: "10.0.1.2", SshPort: 22, User: "ops", Become: true},
+			},
+		},
+		{spec: "10.0.0.1@", wantErr: true},
+		{spec: "10.0.0.1:0", wantErr: true},
+		{spec: "10.0.0.1:65536", wantErr: true},
+		{spec: "10.0.0.1:ssh", wantErr: true},
+		{spec: "[fe80::1]2222", wantErr: true},
+		{spec: "[fe80::1:2222", wantErr: true},
+		{spec: "10.0.0.0/0", wantErr: true},
+		{spec: "bad_host", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseHosts(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHosts(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseHosts(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
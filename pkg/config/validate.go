@@ -0,0 +1,307 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlnode "gopkg.in/yaml.v3"
+)
+
+var (
+	agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]*[A-Za-z0-9])?$`)
+	versionPattern   = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?(\+ent)?$`)
+	// yamlError matches errors reported by strict unmarshalling
+	yamlError = regexp.MustCompile(`line (\d+): (.*)`)
+)
+
+// Problem is a mistake in the config file, Line is 0 when it can't
+// be pointed at
+type Problem struct {
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", File, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", File, p.Line, p.Message)
+}
+
+// ValidationError lists all problems found in the config file
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := []string{fmt.Sprintf("%s has %d problem(s):", File, len(e.Problems))}
+	for _, problem := range e.Problems {
+		lines = append(lines, "  "+problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks the config file for unknown fields, missing or
+// invalid values, duplicate hosts and unreadable SSH keys
+func Validate() error {
+	data, err := ioutil.ReadFile(File)
+	if err != nil {
+		return err
+	}
+	problems := validate(data)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validate(data []byte) []Problem {
+	migrated, version, err := migrate(data)
+	if err != nil {
+		return yamlProblems(err)
+	}
+	// strict pass runs over the file as it is, so lines of problems
+	// point into it, tolerating fields dropped by migrations
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		problems := []Problem{}
+		for _, problem := range yamlProblems(err) {
+			if !removedField(version, problem.Message) {
+				problems = append(problems, problem)
+			}
+		}
+		if len(problems) > 0 {
+			return problems
+		}
+	}
+	config = Config{}
+	if err := yaml.UnmarshalStrict(migrated, &config); err != nil {
+		return yamlProblems(err)
+	}
+	var root yamlnode.Node
+	if err := yamlnode.Unmarshal(data, &root); err != nil {
+		return yamlProblems(err)
+	}
+	if err := config.interpolate(); err != nil {
+		var interpolationErr *interpolationError
+		if errors.As(err, &interpolationErr) {
+			return []Problem{{Line: nodeLine(&root, interpolationErr.path...), Message: err.Error()}}
+		}
+		return []Problem{{Message: err.Error()}}
+	}
+	v := validator{config: &config, root: &root}
+	v.check()
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		return v.problems[i].Line < v.problems[j].Line
+	})
+	return v.problems
+}
+
+// yamlProblems splits yaml error into problems with lines
+func yamlProblems(err error) []Problem {
+	problems := []Problem{}
+	var typeErr *yaml.TypeError
+	messages := []string{err.Error()}
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	for _, message := range messages {
+		match := yamlError.FindStringSubmatch(message)
+		if match == nil {
+			problems = append(problems, Problem{Message: strings.TrimPrefix(message, "yaml: ")})
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		problems = append(problems, Problem{Line: line, Message: match[2]})
+	}
+	return problems
+}
+
+type validator struct {
+	config   *Config
+	root     *yamlnode.Node
+	problems []Problem
+}
+
+func (v *validator) check() {
+	c := v.config
+	if c.DCName == "" {
+		v.report(v.line("dcName"), "dcName is required")
+	}
+	if c.BinaryVersion == "" {
+		v.report(v.line("version"), "version is required")
+	} else if !versionPattern.MatchString(c.BinaryVersion) {
+		v.report(v.line("version"), fmt.Sprintf("invalid version %q, expected like 1.9.5", c.BinaryVersion))
+	}
+	if len(c.Servers) == 0 {
+		v.report(v.line("servers"), "at least one server is required")
+	}
+
+	addresses := map[string]int{}
+	names := map[string]int{}
+	for _, list := range []string{"servers", "clients"} {
+		hosts := c.Servers
+		if list == "clients" {
+			hosts = c.Clients
+		}
+		for i, host := range hosts {
+			v.checkHost(list, i, host, addresses, names)
+		}
+	}
+	for i, jump := range c.JumpHosts {
+		v.checkJump([]interface{}{"jumpHosts", i}, jump)
+	}
+
+	if c.Timeouts.Connect < 0 || c.Timeouts.Command < 0 || c.Timeouts.Upload < 0 {
+		v.report(v.line("timeouts"), "timeouts must not be negative")
+	}
+	if c.Retries.Attempts < 0 || c.Retries.Backoff < 0 {
+		v.report(v.line("retries"), "retries must not be negative")
+	}
+	if c.SSHConfig != "" {
+		v.checkReadable(v.line("sshConfig"), "sshConfig", ExpandPath(c.SSHConfig))
+	}
+}
+
+func (v *validator) checkHost(list string, i int, host Host, addresses, names map[string]int) {
+	line := v.line(list, i)
+	if host.Address == "" {
+		v.report(line, "address is required")
+	} else if err := ValidateAddress(host.Address); err != nil {
+		v.report(v.line(list, i, "address"), err.Error())
+	} else {
+		key := fmt.Sprintf("%s:%d", host.Address, host.SshPort)
+		if first, ok := addresses[key]; ok {
+			v.report(v.line(list, i, "address"), fmt.Sprintf("duplicate address %s, first used at line %d", host.Address, first))
+		} else {
+			addresses[key] = v.line(list, i, "address")
+		}
+	}
+	// hosts without agentName get their remote hostname
+	if host.AgentName != "" {
+		if !agentNamePattern.MatchString(host.AgentName) {
+			v.report(v.line(list, i, "agentName"), fmt.Sprintf("invalid agentName %q, only letters, digits, '.', '_' and '-' are allowed", host.AgentName))
+		} else if first, ok := names[host.AgentName]; ok {
+			v.report(v.line(list, i, "agentName"), fmt.Sprintf("duplicate agentName %s, first used at line %d", host.AgentName, first))
+		} else {
+			names[host.AgentName] = v.line(list, i, "agentName")
+		}
+	}
+	if host.User == "" {
+		v.report(line, "user is required")
+	}
+	v.checkPort(v.line(list, i, "sshPort"), host.SshPort)
+	switch host.BecomeMethod {
+	case "", "sudo":
+	case "doas":
+		if host.BecomePassword {
+			v.report(v.line(list, i, "becomePassword"), "becomePassword is not supported with doas")
+		}
+	case "su":
+		if host.Become && !host.BecomePassword {
+			v.report(v.line(list, i, "becomeMethod"), "su requires root password, set becomePassword: true")
+		}
+	default:
+		v.report(v.line(list, i, "becomeMethod"), fmt.Sprintf("unknown becomeMethod %q, expected sudo, su or doas", host.BecomeMethod))
+	}
+	for j, jump := range host.JumpHosts {
+		v.checkJump([]interface{}{list, i, "jumpHosts", j}, jump)
+	}
+
+	if v.config.UseSSHAgent(host) || v.config.UsePasswordAuth(host) {
+		return
+	}
+	if host.SSHKey != "" {
+		v.checkReadable(v.line(list, i, "sshKey"), "sshKey", v.config.SSHKeyPath(host))
+	} else if v.config.SSHKey != "" {
+		v.checkReadable(v.line("sshKey"), "sshKey", v.config.SSHKeyPath(host))
+	}
+}
+
+func (v *validator) checkJump(path []interface{}, jump JumpHost) {
+	if jump.Address == "" {
+		v.report(v.line(path...), "address of jump host is required")
+	}
+	if jump.SshPort != 0 {
+		v.checkPort(v.line(append(path, "sshPort")...), jump.SshPort)
+	}
+	if jump.SSHKey != "" {
+		v.checkReadable(v.line(append(path, "sshKey")...), "sshKey", ExpandPath(jump.SSHKey))
+	}
+}
+
+func (v *validator) checkPort(line int, port int64) {
+	if port < 1 || port > 65535 {
+		v.report(line, fmt.Sprintf("sshPort %d is out of range 1-65535", port))
+	}
+}
+
+// checkReadable reports file which can't be read, each file once
+func (v *validator) checkReadable(line int, field, path string) {
+	file, err := os.Open(path)
+	if err == nil {
+		file.Close()
+		return
+	}
+	problem := Problem{Line: line, Message: fmt.Sprintf("%s is not readable: %s", field, err)}
+	for _, p := range v.problems {
+		if p == problem {
+			return
+		}
+	}
+	v.problems = append(v.problems, problem)
+}
+
+func (v *validator) report(line int, message string) {
+	v.problems = append(v.problems, Problem{Line: line, Message: message})
+}
+
+// line returns line of the node at path of mapping keys and sequence
+// indices, or of its deepest existing parent
+func (v *validator) line(path ...interface{}) int {
+	return nodeLine(v.root, path...)
+}
+
+// nodeLine returns line of the node at path from root, or of its
+// deepest existing parent
+func nodeLine(root *yamlnode.Node, path ...interface{}) int {
+	node := root
+	if node.Kind == yamlnode.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, element := range path {
+		var next *yamlnode.Node
+		switch element := element.(type) {
+		case string:
+			if node.Kind != yamlnode.MappingNode {
+				return line
+			}
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == element {
+					line = node.Content[i].Line
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case int:
+			if node.Kind != yamlnode.SequenceNode || element >= len(node.Content) {
+				return line
+			}
+			next = node.Content[element]
+			line = next.Line
+		}
+		if next == nil {
+			return line
+		}
+		node = next
+	}
+	return line
+}
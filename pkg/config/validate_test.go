@@ -0,0 +1,101 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+const validConfig = `schemaVersion: 2
+dcName: dc1
+version: 1.10.0
+servers:
+- address: 10.0.0.1
+  sshPort: 22
+  user: root
+  agentName: server1
+`
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		problems []Problem
+	}{
+		{"valid", validConfig, nil},
+		{
+			name: "duplicate agent names",
+			config: validConfig + `clients:
+- address: 10.0.0.2
+  sshPort: 22
+  user: root
+  agentName: server1
+`,
+			problems: []Problem{{Line: 13, Message: "duplicate agentName server1, first used at line 8"}},
+		},
+		{
+			name: "bad agent name",
+			config: validConfig + `clients:
+- address: 10.0.0.2
+  sshPort: 22
+  user: root
+  agentName: client_
+`,
+			problems: []Problem{{Line: 13, Message: `invalid agentName "client_", only letters, digits, '.', '_' and '-' are allowed`}},
+		},
+		{
+			name: "bad ports",
+			config: validConfig + `clients:
+- address: 10.0.0.2
+  sshPort: 70000
+  user: root
+jumpHosts:
+- address: 10.0.0.100
+  sshPort: -1
+`,
+			problems: []Problem{
+				{Line: 11, Message: "sshPort 70000 is out of range 1-65535"},
+				{Line: 15, Message: "sshPort -1 is out of range 1-65535"},
+			},
+		},
+		{
+			name: "duplicate address",
+			config: validConfig + `clients:
+- address: 10.0.0.1
+  sshPort: 22
+  user: root
+`,
+			problems: []Problem{{Line: 10, Message: "duplicate address 10.0.0.1, first used at line 5"}},
+		},
+		{
+			name:     "missing key file",
+			config:   validConfig + "sshKey: /nonexistent/id_rsa\n",
+			problems: []Problem{{Line: 9, Message: "sshKey is not readable: open /nonexistent/id_rsa: no such file or directory"}},
+		},
+		{
+			name:     "unknown field",
+			config:   validConfig + "  sshUser: root\n",
+			problems: []Problem{{Line: 9, Message: "field sshUser not found in type config.Host"}},
+		},
+		{
+			name:     "su without password",
+			config:   validConfig + "  become: true\n  becomeMethod: su\n",
+			problems: []Problem{{Line: 10, Message: "su requires root password, set becomePassword: true"}},
+		},
+		{
+			name:   "missing required fields",
+			config: "schemaVersion: 2\nservers:\n- sshPort: 22\n",
+			problems: []Problem{
+				{Line: 1, Message: "dcName is required"},
+				{Line: 1, Message: "version is required"},
+				{Line: 3, Message: "address is required"},
+				{Line: 3, Message: "user is required"},
+			},
+		},
+	}
+	for _, test := range tests {
+		problems := validate([]byte(test.config))
+		if !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s: problems = %+v, want %+v", test.name, problems, test.problems)
+		}
+	}
+}
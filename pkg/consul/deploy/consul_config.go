@@ -6,128 +6,97 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"os"
 	"strings"
 	"text/template"
 
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
 )
 
-func (c *Consul) DeployConsulConfigs() error {
+// DeployConfig renders common and role specific consul configs
+// and deploys them on the host
+func (c *Consul) DeployConfig(host config.Host) error {
+	role := c.Cfg.Role(host)
 	commonTpl, err := template.New("consul.hcl").ParseFS(c.Templates, "templates/consul.hcl")
 	if err != nil {
 		return err
 	}
-	serverTpl, err := template.New("consul-server.hcl").ParseFS(c.Templates, "templates/consul-server.hcl")
-	if err != nil {
-		return err
-	}
-	clientTpl, err := template.New("consul-client.hcl").ParseFS(c.Templates, "templates/consul-client.hcl")
+	roleTpl, err := template.New(fmt.Sprintf("consul-%s.hcl", role)).
+		ParseFS(c.Templates, fmt.Sprintf("templates/consul-%s.hcl", role))
 	if err != nil {
 		return err
 	}
 
 	parameters := make(map[string]string)
 	parameters["DCName"] = c.Cfg.DCName
+	parameters["Address"] = host.Address
 	if c.Cfg.GossipEnabled {
-		log.Println("Generating gossip key")
-		parameters["GossipKey"], err = c.GenerateGossipKey()
+		parameters["GossipKey"], err = c.gossipKey()
 		if err != nil {
 			return err
 		}
-		log.Println("Generated gossip key: ", parameters["GossipKey"])
 	}
 	if c.Cfg.ACLEnabled {
-		log.Println("Enabling ACL")
 		parameters["ACLEnabled"] = "true"
 	}
 	if c.Cfg.TLSEnabled {
-		log.Println("Enabling TLS")
 		parameters["CACertFile"] = "consul-agent-ca.pem"
+		parameters["CertFile"], parameters["KeyFile"] = c.certFiles(host)
 	}
-
 	servers := []string{}
 	for _, server := range c.Cfg.Servers {
 		servers = append(servers, fmt.Sprintf("\"%s\"", server.Address))
 	}
+	parameters["Servers"] = "[" + strings.Join(servers, ",") + "]"
+	if len(host.ConsulNodeMeta) > 0 {
+		parameters["NodeMeta"] = "{\n  " + strings.Join(config.HCLAttributes(host.ConsulNodeMeta), "\n  ") + "\n}"
+	}
 
-	for _, host := range c.Cfg.Clients {
-		parameters["Address"] = host.Address
-		if c.Cfg.TLSEnabled {
-			parameters["CertFile"] = fmt.Sprintf("%s-client-consul-%d.pem", c.Cfg.DCName, host.Number)
-			parameters["KeyFile"] = fmt.Sprintf("%s-client-consul-%d-key.pem", c.Cfg.DCName, host.Number)
-		}
+	commonConfig := bytes.Buffer{}
+	roleConfig := bytes.Buffer{}
+	if err := commonTpl.Execute(&commonConfig, parameters); err != nil {
+		return err
+	}
+	if err := roleTpl.Execute(&roleConfig, parameters); err != nil {
+		return err
+	}
 
-		commonConfig := bytes.Buffer{}
-		clientConfig := bytes.Buffer{}
-		if err := commonTpl.Execute(&commonConfig, parameters); err != nil {
-			return err
-		}
-		err := clientTpl.Execute(&clientConfig, map[string]string{"Servers": "[" + strings.Join(servers, ",") + "]"})
-		if err != nil {
-			return err
-		}
-		commonFile, err := ioutil.TempFile("", fmt.Sprintf("consul.hcl%d", host.Number))
-		if err != nil {
-			return err
-		}
-		defer commonFile.Close()
-		serverFile, err := ioutil.TempFile("", fmt.Sprintf("consul-client.hcl%d", host.Number))
-		if err != nil {
-			return err
-		}
-		defer serverFile.Close()
-		if _, err := io.Copy(commonFile, &commonConfig); err != nil {
-			return err
-		}
-		if _, err := io.Copy(serverFile, &clientConfig); err != nil {
-			return err
-		}
-		if err := ssh.Scp(host, c.Cfg, commonFile.Name(), "/etc/consul.d/consul.hcl"); err != nil {
-			return err
-		}
-		if err := ssh.Scp(host, c.Cfg, serverFile.Name(), "/etc/consul.d/consul-client.hcl"); err != nil {
-			return err
-		}
+	if err := c.uploadBuffer(host, &commonConfig, "/etc/consul.d/consul.hcl"); err != nil {
+		return err
 	}
+	return c.uploadBuffer(host, &roleConfig, fmt.Sprintf("/etc/consul.d/consul-%s.hcl", role))
+}
 
-	for _, host := range c.Cfg.Servers {
-		parameters["Address"] = host.Address
-		if c.Cfg.TLSEnabled {
-			parameters["CertFile"] = fmt.Sprintf("%s-server-consul-%d.pem", c.Cfg.DCName, host.Number)
-			parameters["KeyFile"] = fmt.Sprintf("%s-server-consul-%d-key.pem", c.Cfg.DCName, host.Number)
-		}
+// gossipKey returns gossip key of the cluster, generating it on
+// first call. Key must stay the same across deploys, otherwise
+// agents of already running cluster can't talk to each other.
+func (c *Consul) gossipKey() (string, error) {
+	if c.Cfg.Secrets.Consul.GossipKey != "" {
+		return c.Cfg.Secrets.Consul.GossipKey, nil
+	}
+	if c.Secrets.GossipKey != "" {
+		return c.Secrets.GossipKey, nil
+	}
+	log.Println("Generating gossip key")
+	key, err := c.GenerateGossipKey()
+	if err != nil {
+		return "", err
+	}
+	c.Secrets.GossipKey = key
+	return key, nil
+}
 
-		commonConfig := bytes.Buffer{}
-		serverConfig := bytes.Buffer{}
-		if err := commonTpl.Execute(&commonConfig, parameters); err != nil {
-			return err
-		}
-		if err := serverTpl.Execute(&serverConfig, parameters); err != nil {
-			return err
-		}
-		commonFile, err := ioutil.TempFile("", fmt.Sprintf("consul.hcl%d", host.Number))
-		if err != nil {
-			return err
-		}
-		defer commonFile.Close()
-		serverFile, err := ioutil.TempFile("", fmt.Sprintf("consul-server.hcl%d", host.Number))
-		if err != nil {
-			return err
-		}
-		defer serverFile.Close()
-		if _, err := io.Copy(commonFile, &commonConfig); err != nil {
-			return err
-		}
-		if _, err := io.Copy(serverFile, &serverConfig); err != nil {
-			return err
-		}
-		if err := ssh.Scp(host, c.Cfg, commonFile.Name(), "/etc/consul.d/consul.hcl"); err != nil {
-			return err
-		}
-		if err := ssh.Scp(host, c.Cfg, serverFile.Name(), "/etc/consul.d/consul-server.hcl"); err != nil {
-			return err
-		}
+func (c *Consul) uploadBuffer(host config.Host, content io.Reader, remotePath string) error {
+	tmp, err := ioutil.TempFile("", "consul-config")
+	if err != nil {
+		return err
 	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 
-	return nil
+	if _, err := io.Copy(tmp, content); err != nil {
+		return err
+	}
+	return c.upload(host, tmp.Name(), remotePath, ssh.ModeConfig)
 }
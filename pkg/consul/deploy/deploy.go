@@ -8,19 +8,29 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"regexp"
 	"strings"
 
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/rollback"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
 )
 
 //go:embed templates
 var templates embed.FS
 
+// Templates are config and unit file templates deployed on hosts
+var Templates fs.FS = templates
+
 type Consul struct {
 	ConsulBinPath string
 	Cfg           *config.Config
 	Templates     fs.FS
+	State         *state.Component
+	Secrets       *secrets.Component
 }
 
 func NewDeployer(Cfg *config.Config) (*Consul, error) {
@@ -91,31 +101,56 @@ func unzip(zipFile string) (string, error) {
 	return result.Name(), nil
 }
 
-func (c *Consul) DeployBinary() error {
-	allHosts := append(c.Cfg.Clients, c.Cfg.Servers...)
-	for _, host := range allHosts {
-		// check if binary already exists
-		bins, err := ssh.Ssh(host, c.Cfg, "ls /usr/local/bin/")
+// DeployBinary copies consul binary on the host, unless it is
+// already there
+func (c *Consul) DeployBinary(host config.Host) error {
+	bins, err := ssh.SshRetry(host, c.Cfg, "ls /usr/local/bin/")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(bins, "consul") {
+		// binary is kept, but state records which version it is
+		output, err := ssh.SshRetry(host, c.Cfg, "/usr/local/bin/consul version")
 		if err != nil {
 			return err
 		}
-		if strings.Contains(bins, "consul") {
-			continue
+		version := installedVersion(output)
+		c.State.Host(c.Cfg, host).BinaryVersion = version
+		if c.State.BinaryVersion == "" {
+			c.State.BinaryVersion = version
 		}
+		return nil
+	}
 
-		if err := ssh.Scp(host, c.Cfg, c.ConsulBinPath, "/usr/local/bin/consul"); err != nil {
-			return err
-		}
+	if err := c.upload(host, c.ConsulBinPath, "/usr/local/bin/consul", ssh.ModeBinary); err != nil {
+		return err
 	}
+	c.State.Host(c.Cfg, host).BinaryVersion = c.Cfg.BinaryVersion
+	c.State.BinaryVersion = c.Cfg.BinaryVersion
 	return nil
 }
 
-// CreateDir creates remote directory with specified path
-func (c *Consul) CreateDir(dirpath string) error {
-	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		if _, err := ssh.Ssh(host, c.Cfg, fmt.Sprintf("mkdir -p %s", dirpath)); err != nil {
-			return err
-		}
+// versionLine matches the first line of `consul version` output
+var versionLine = regexp.MustCompile(`(?m)^Consul v(\S+)`)
+
+// installedVersion returns version from output of `consul version`,
+// which starts with line like "Consul v1.2.3"
+func installedVersion(output string) string {
+	match := versionLine.FindStringSubmatch(output)
+	if match == nil {
+		return ""
 	}
-	return nil
+	return match[1]
+}
+
+// CreateDir creates remote directory with specified path
+func (c *Consul) CreateDir(host config.Host, dirpath string) error {
+	_, err := ssh.SshRetry(host, c.Cfg, fmt.Sprintf("mkdir -p %s", dirpath))
+	return err
+}
+
+// upload replaces remote file backing up its previous version
+// for rollback
+func (c *Consul) upload(host config.Host, localPath, remotePath string, mode os.FileMode) error {
+	return rollback.Upload(host, c.Cfg, c.State.Host(c.Cfg, host), localPath, remotePath, mode)
 }
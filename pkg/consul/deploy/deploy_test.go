@@ -0,0 +1,16 @@
+package deploy
+
+import "testing"
+
+func TestInstalledVersion(t *testing.T) {
+	tests := map[string]string{
+		"Consul v1.10.3\nRevision c976ffd2d\n": "1.10.3",
+		"Consul v1.2.0-beta1 (abcdef)\n":       "1.2.0-beta1",
+		"command not found\n":                  "",
+	}
+	for output, expected := range tests {
+		if version := installedVersion(output); version != expected {
+			t.Errorf("version of %q is %q, expected %q", output, version, expected)
+		}
+	}
+}
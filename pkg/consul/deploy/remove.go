@@ -1,13 +1,62 @@
 package deploy
 
-import "gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/runlog"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+// Leave makes every agent gracefully leave the cluster, clients
+// first, so servers are removed from raft peers properly
+func (c *Consul) Leave(timeout time.Duration) error {
+	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
+		log.Printf("Leaving cluster on %s (%s)\n", host.AgentName, host.Address)
+		if err := c.leave(host, timeout); err != nil {
+			return fmt.Errorf("%s (%s) failed to leave: %w", host.AgentName, host.Address, err)
+		}
+	}
+	return nil
+}
+
+func (c *Consul) leave(host config.Host, timeout time.Duration) error {
+	command, opts := c.cli(fmt.Sprintf("timeout %d consul leave", int(timeout.Seconds())), ssh.Options{})
+	_, err := ssh.SshWith(host, c.Cfg, command, opts)
+	return err
+}
+
+// cli returns consul CLI command authorized with ACL token and options
+// of the command. The token is passed on stdin rather than command
+// line, where any user of the host could see it.
+func (c *Consul) cli(command string, opts ssh.Options) (string, ssh.Options) {
+	token := c.token()
+	if token == "" {
+		return command, opts
+	}
+	runlog.Redact(token)
+	opts.Input = token + "\n"
+	return "read -r CONSUL_HTTP_TOKEN && export CONSUL_HTTP_TOKEN && " + command, opts
+}
+
+// token returns ACL token from config or the bootstrapped one
+func (c *Consul) token() string {
+	if c.Cfg.Secrets.Consul.ACLToken != "" {
+		return c.Cfg.Secrets.Consul.ACLToken
+	}
+	return c.Secrets.BootstrapToken
+}
 
 func (c *Consul) DeleteServices() error {
 	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		_, err := ssh.Ssh(
+		_, err := ssh.SshRetry(
 			host,
 			c.Cfg,
-			"bash -c \"systemctl stop consul; systemctl disable consul; rm -f /etc/systemd/system/consul.service\"")
+			"bash -c \"systemctl disable --now consul-snapshot.timer; systemctl stop consul; systemctl disable consul; "+
+				"rm -f /etc/systemd/system/consul.service /etc/systemd/system/consul-snapshot.service "+
+				"/etc/systemd/system/consul-snapshot.timer /etc/consul.d/snapshot.env; systemctl daemon-reload\"")
 		if err != nil {
 			return err
 		}
@@ -17,7 +66,7 @@ func (c *Consul) DeleteServices() error {
 
 func (c *Consul) DeleteConfigs() error {
 	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		_, err := ssh.Ssh(host, c.Cfg, "bash -c \"rm -rf /etc/consul.d\"")
+		_, err := ssh.SshRetry(host, c.Cfg, "bash -c \"rm -rf /etc/consul.d\"")
 		if err != nil {
 			return err
 		}
@@ -27,7 +76,7 @@ func (c *Consul) DeleteConfigs() error {
 
 func (c *Consul) DeleteData() error {
 	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		_, err := ssh.Ssh(host, c.Cfg, "bash -c \"rm -rf /opt/consul\"")
+		_, err := ssh.SshRetry(host, c.Cfg, "bash -c \"rm -rf /opt/consul\"")
 		if err != nil {
 			return err
 		}
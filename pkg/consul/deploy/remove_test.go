@@ -0,0 +1,26 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+func TestCLI(t *testing.T) {
+	c := &Consul{Cfg: &config.Config{}, Secrets: &secrets.Component{}}
+	if command, opts := c.cli("consul members", ssh.Options{}); command != "consul members" || opts.Input != "" {
+		t.Errorf("command without token %q %+v", command, opts)
+	}
+
+	c.Cfg.Secrets.Consul.ACLToken = "secret-token"
+	command, opts := c.cli("consul members", ssh.Options{})
+	if strings.Contains(command, "secret-token") {
+		t.Errorf("token is on command line: %s", command)
+	}
+	if command != "read -r CONSUL_HTTP_TOKEN && export CONSUL_HTTP_TOKEN && consul members" || opts.Input != "secret-token\n" {
+		t.Errorf("token is not read from stdin: %q %+v", command, opts)
+	}
+}
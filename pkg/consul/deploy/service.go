@@ -5,50 +5,46 @@ import (
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"os"
 
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
 )
 
-func (c *Consul) DeployServices() error {
+// DeployService deploys systemd consul.service file on the host
+func (c *Consul) DeployService(host config.Host) error {
 	tpl, err := template.New("consul.service").ParseFS(c.Templates, "templates/consul.service")
 	if err != nil {
 		return err
 	}
-	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		renderedService := bytes.Buffer{}
-		err = tpl.Execute(&renderedService, map[string]string{
-			"AgentName": host.AgentName,
-		})
-		if err != nil {
-			return err
-		}
-
-		tmpFile, err := ioutil.TempFile("", fmt.Sprintf("consul.service%s", host.Address))
-		if err != nil {
-			return err
-		}
-		defer tmpFile.Close()
+	renderedService := bytes.Buffer{}
+	err = tpl.Execute(&renderedService, map[string]string{
+		"AgentName": host.AgentName,
+	})
+	if err != nil {
+		return err
+	}
 
-		_, err = tmpFile.Write(renderedService.Bytes())
-		if err != nil {
-			return err
-		}
+	tmpFile, err := ioutil.TempFile("", fmt.Sprintf("consul.service%s", host.Address))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
 
-		if err = ssh.Scp(host, c.Cfg, tmpFile.Name(), "/etc/systemd/system/consul.service"); err != nil {
-			return err
-		}
+	_, err = tmpFile.Write(renderedService.Bytes())
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return c.upload(host, tmpFile.Name(), "/etc/systemd/system/consul.service", ssh.ModeConfig)
 }
 
-func (c *Consul) StartServices() error {
-	for _, host := range append(c.Cfg.Servers, c.Cfg.Clients...) {
-		if _, err := ssh.Ssh(host, c.Cfg, "systemctl enable consul.service"); err != nil {
-			return err
-		}
-		if _, err := ssh.Ssh(host, c.Cfg, "systemctl start consul.service"); err != nil {
-			return err
-		}
+// StartService enables and starts consul.service on the host
+func (c *Consul) StartService(host config.Host) error {
+	if _, err := ssh.SshRetry(host, c.Cfg, "systemctl enable consul.service"); err != nil {
+		return err
 	}
-	return nil
+	_, err := ssh.SshRetry(host, c.Cfg, "systemctl start consul.service")
+	return err
 }
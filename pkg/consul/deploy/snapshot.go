@@ -0,0 +1,138 @@
+package deploy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+// SnapshotDir is where scheduled snapshots are kept on servers
+const SnapshotDir = "/opt/consul-snapshots"
+
+// SaveSnapshot takes snapshot of cluster state on the first
+// server, verifies it and downloads it to localPath
+func (c *Consul) SaveSnapshot(localPath string) error {
+	host, err := c.snapshotServer()
+	if err != nil {
+		return err
+	}
+	remotePath := fmt.Sprintf("/tmp/consul-%d.snap", time.Now().Unix())
+	defer ssh.SshRetry(host, c.Cfg, fmt.Sprintf("rm -f %s", remotePath))
+
+	log.Printf("Saving snapshot on %s (%s)\n", host.AgentName, host.Address)
+	command, opts := c.cli("consul snapshot save "+remotePath, ssh.Options{})
+	if _, err := ssh.SshWith(host, c.Cfg, command, opts); err != nil {
+		return err
+	}
+	if err := c.inspectSnapshot(host, remotePath); err != nil {
+		return err
+	}
+	log.Printf("Downloading snapshot to %s\n", localPath)
+	return ssh.Download(host, c.Cfg, remotePath, localPath)
+}
+
+// RestoreSnapshot uploads local snapshot to the first server,
+// verifies it and restores cluster state from it
+func (c *Consul) RestoreSnapshot(localPath string) error {
+	host, err := c.snapshotServer()
+	if err != nil {
+		return err
+	}
+	remotePath := fmt.Sprintf("/tmp/consul-%d.snap", time.Now().Unix())
+	log.Printf("Uploading snapshot to %s (%s)\n", host.AgentName, host.Address)
+	if err := ssh.Scp(host, c.Cfg, localPath, remotePath, ssh.ModeSecret); err != nil {
+		return err
+	}
+	defer ssh.SshRetry(host, c.Cfg, fmt.Sprintf("rm -f %s", remotePath))
+
+	if err := c.inspectSnapshot(host, remotePath); err != nil {
+		return err
+	}
+	log.Println("Restoring snapshot")
+	command, opts := c.cli("consul snapshot restore "+remotePath, ssh.Options{})
+	_, err = ssh.SshWith(host, c.Cfg, command, opts)
+	return err
+}
+
+func (c *Consul) inspectSnapshot(host config.Host, remotePath string) error {
+	output, err := ssh.SshRetry(host, c.Cfg, fmt.Sprintf("consul snapshot inspect %s", remotePath))
+	if err != nil {
+		return fmt.Errorf("snapshot verification failed: %w", err)
+	}
+	fmt.Print(output)
+	return nil
+}
+
+func (c *Consul) snapshotServer() (config.Host, error) {
+	if len(c.Cfg.Servers) == 0 {
+		return config.Host{}, errors.New("no servers in config")
+	}
+	return c.Cfg.Servers[0], nil
+}
+
+// ScheduleSnapshots installs systemd timer on every server, which
+// saves snapshot into SnapshotDir every interval (systemd calendar
+// expression) keeping only last keep of them
+func (c *Consul) ScheduleSnapshots(interval string, keep int) error {
+	if keep < 1 {
+		return errors.New("at least one snapshot must be kept")
+	}
+	parameters := map[string]interface{}{
+		"Dir":        SnapshotDir,
+		"FirstStale": keep + 1,
+		"Interval":   interval,
+	}
+	files := map[string]string{
+		"consul-snapshot.service": "/etc/systemd/system/consul-snapshot.service",
+		"consul-snapshot.timer":   "/etc/systemd/system/consul-snapshot.timer",
+	}
+	tempDir, err := ioutil.TempDir("", "consul-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	for name := range files {
+		tpl, err := template.New(name).ParseFS(c.Templates, "templates/"+name)
+		if err != nil {
+			return err
+		}
+		rendered := bytes.Buffer{}
+		if err := tpl.Execute(&rendered, parameters); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, name), rendered.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	envFile := filepath.Join(tempDir, "snapshot.env")
+	if err := os.WriteFile(envFile, []byte(fmt.Sprintf("CONSUL_HTTP_TOKEN=%s\n", c.token())), 0600); err != nil {
+		return err
+	}
+
+	for _, host := range c.Cfg.Servers {
+		log.Printf("Scheduling snapshots on %s (%s)\n", host.AgentName, host.Address)
+		for name, remotePath := range files {
+			if err := ssh.Scp(host, c.Cfg, filepath.Join(tempDir, name), remotePath, ssh.ModeConfig); err != nil {
+				return err
+			}
+		}
+		if err := ssh.Scp(host, c.Cfg, envFile, "/etc/consul.d/snapshot.env", ssh.ModeSecret); err != nil {
+			return err
+		}
+		_, err := ssh.SshRetry(host, c.Cfg,
+			"systemctl daemon-reload; systemctl enable --now consul-snapshot.timer")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
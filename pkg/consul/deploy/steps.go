@@ -0,0 +1,80 @@
+package deploy
+
+import (
+	"os"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/pipeline"
+)
+
+// Steps returns deployment plan of consul cluster
+func (c *Consul) Steps() []pipeline.Step {
+	var certDir string
+	steps := []pipeline.Step{
+		{
+			Name:        "binary",
+			Description: "Deploying consul binary to all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run:         c.DeployBinary,
+		},
+		{
+			Name:        "services",
+			Description: "Deploying service files to all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run:         c.DeployService,
+		},
+		{
+			Name:        "config-dir",
+			Description: "Create config directory on all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run: func(host config.Host) error {
+				return c.CreateDir(host, "/etc/consul.d/")
+			},
+		},
+		{
+			Name:        "configs",
+			Description: "Deploying consul configs to all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run:         c.DeployConfig,
+		},
+		{
+			Name:        "certificates",
+			Description: "Generating and deploying TLS certificates",
+			Hosts:       c.Cfg.AllHosts,
+			Once: func() (err error) {
+				certDir, err = c.GenerateCertificates()
+				return err
+			},
+			Run: func(host config.Host) error {
+				return c.DeployCertificates(host, certDir)
+			},
+			Cleanup: func() {
+				if certDir != "" {
+					os.RemoveAll(certDir)
+				}
+			},
+		},
+		{
+			Name:        "data-dir",
+			Description: "Creating data directories on all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run: func(host config.Host) error {
+				return c.CreateDir(host, "/opt/consul/")
+			},
+		},
+		{
+			Name:        "start",
+			Description: "Enabling and starting consul services on all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run:         c.StartService,
+		},
+	}
+	if c.Cfg.ACLEnabled {
+		steps = append(steps, pipeline.Step{
+			Name:        "acl-bootstrap",
+			Description: "Bootstrapping ACL system",
+			Once:        c.BootstrapACL,
+		})
+	}
+	return steps
+}
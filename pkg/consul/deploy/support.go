@@ -0,0 +1,121 @@
+package deploy
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sync"
+	"time"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/runlog"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+// secretSetting matches config lines holding gossip key or tokens,
+// either legacy acl_*_token ones or those of acl.tokens block
+var secretSetting = regexp.MustCompile(
+	`(?m)^(\s*(encrypt|token|[a-z_]*_token|initial_management|agent|agent_recovery|master|agent_master|replication|default)\s*=\s*).*$`)
+
+// Logs prints journal of consul service on hosts, following it
+// when follow is set, each line prefixed with host name
+func (c *Consul) Logs(hosts []config.Host, since time.Duration, follow bool, w io.Writer) error {
+	command := fmt.Sprintf("journalctl -u consul --no-pager -o short-iso --since -%ds", int(since.Seconds()))
+	if follow {
+		command += " --follow"
+	}
+
+	errs := make([]error, len(hosts))
+	wg := sync.WaitGroup{}
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host config.Host) {
+			defer wg.Done()
+			out := runlog.Tee(host.AgentName, "journal", w)
+			errs[i] = ssh.Stream(host, c.Cfg, command, out)
+			out.Close()
+		}(i, host)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%s (%s): %w", hosts[i].AgentName, hosts[i].Address, err)
+		}
+	}
+	return nil
+}
+
+// SupportBundle gathers journal, rendered configs with secrets
+// redacted, service status, versions and cluster members from every
+// host into tar.gz archive at localPath. Unreachable hosts don't stop
+// gathering, their errors are put into the archive instead.
+func (c *Consul) SupportBundle(localPath string, since time.Duration) error {
+	file, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+	root := fmt.Sprintf("consul-support-%s", time.Now().Format("20060102-150405"))
+
+	members, membersOpts := c.cli("consul members", ssh.Options{})
+	commands := []struct {
+		name    string
+		command string
+		opts    ssh.Options
+	}{
+		{"journal.log", fmt.Sprintf("journalctl -u consul --no-pager -o short-iso --since -%ds", int(since.Seconds())), ssh.Options{}},
+		{"status.txt", "systemctl status consul --no-pager", ssh.Options{}},
+		{"version.txt", "consul version", ssh.Options{}},
+		{"configs.hcl", `for f in /etc/consul.d/*.hcl; do echo "# $f"; cat "$f"; done`, ssh.Options{}},
+		{"members.txt", members, membersOpts},
+	}
+	for _, host := range c.Cfg.AllHosts() {
+		log.Printf("Gathering support info from %s (%s)\n", host.AgentName, host.Address)
+		for _, command := range commands {
+			output, exitCode, sshErr := ssh.OutputWith(host, c.Cfg, command.command, command.opts)
+			if sshErr != nil {
+				output = fmt.Sprintf("%s\nerror: %s\n", output, sshErr)
+			} else if exitCode != 0 {
+				output = fmt.Sprintf("%s\nexit code: %d\n", output, exitCode)
+			}
+			output = runlog.RedactString(secretSetting.ReplaceAllString(output, `${1}"<redacted>"`))
+			if err := addFile(archive, path.Join(root, host.AgentName, command.name), []byte(output)); err != nil {
+				return err
+			}
+			if sshErr != nil {
+				// host is unreachable, other commands would fail too
+				break
+			}
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func addFile(archive *tar.Writer, name string, content []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := archive.Write(content)
+	return err
+}
@@ -0,0 +1,24 @@
+package deploy
+
+import "testing"
+
+func TestSecretSetting(t *testing.T) {
+	tests := map[string]string{
+		`encrypt = "c2VjcmV0"`:              `encrypt = "<redacted>"`,
+		`  acl_master_token = "abc"`:        `  acl_master_token = "<redacted>"`,
+		`token="abc"`:                       `token="<redacted>"`,
+		`    initial_management = "abc"`:    `    initial_management = "<redacted>"`,
+		`    agent = "abc"`:                 `    agent = "<redacted>"`,
+		`    default = "abc"`:               `    default = "<redacted>"`,
+		`  enable_token_persistence = true`: `  enable_token_persistence = true`,
+		`  default_policy = "deny"`:         `  default_policy = "deny"`,
+		`encrypt_verify_incoming = true`:    `encrypt_verify_incoming = true`,
+		`node_name = "agent"`:               `node_name = "agent"`,
+		`  tokens {`:                        `  tokens {`,
+	}
+	for line, expected := range tests {
+		if redacted := secretSetting.ReplaceAllString(line, `${1}"<redacted>"`); redacted != expected {
+			t.Errorf("%q is redacted to %q, expected %q", line, redacted, expected)
+		}
+	}
+}
@@ -17,6 +17,9 @@ key_file = "/etc/consul.d/{{ .KeyFile }}"
 {{ end }}
 client_addr = "127.0.0.1 {{ .Address }}"
 bind_addr = "{{ .Address }}"
+{{ if .NodeMeta }}
+node_meta = {{ .NodeMeta }}
+{{ end }}
 acl = {
   {{ if .ACLEnabled }}
   enabled = {{ .ACLEnabled }}
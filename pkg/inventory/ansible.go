@@ -0,0 +1,371 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ansibleRange matches host ranges like web[01:10]
+var ansibleRange = regexp.MustCompile(`\[(\d+):(\d+)\]`)
+
+// ansibleInventory is inventory parsed from INI or YAML
+type ansibleInventory struct {
+	hostOrder  []string
+	hostVars   map[string]map[string]string
+	groupOrder []string
+	members    map[string][]string
+	children   map[string][]string
+	groupVars  map[string]map[string]string
+}
+
+func loadAnsible(path string) ([]Group, error) {
+	inv := &ansibleInventory{
+		hostVars:  map[string]map[string]string{},
+		members:   map[string][]string{},
+		children:  map[string][]string{},
+		groupVars: map[string]map[string]string{},
+	}
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml", ".json":
+		err = inv.readYAML(path)
+	default:
+		err = inv.readINI(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return inv.groups()
+}
+
+func (inv *ansibleInventory) readINI(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	section, kind := "ungrouped", "hosts"
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section, kind = line[1:len(line)-1], "hosts"
+			if i := strings.Index(section, ":"); i >= 0 {
+				section, kind = section[:i], section[i+1:]
+			}
+			inv.group(section)
+			continue
+		}
+
+		fields, err := splitFields(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		switch kind {
+		case "hosts":
+			vars, err := parseVars(fields[1:])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			if err := inv.addHosts(section, fields[0], vars); err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		case "children":
+			inv.addChild(section, fields[0])
+		case "vars":
+			// spaces are allowed around = in vars sections
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("line %d: invalid variable %q, expected key=value", lineNumber, line)
+			}
+			value, err := splitFields(parts[1])
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			inv.setGroupVars(section, map[string]string{
+				strings.TrimSpace(parts[0]): strings.Join(value, " "),
+			})
+		default:
+			return fmt.Errorf("line %d: unknown section kind %q", lineNumber, kind)
+		}
+	}
+	return scanner.Err()
+}
+
+// parseVars parses key=value fields split by splitFields
+func parseVars(fields []string) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid variable %q, expected key=value", field)
+		}
+		vars[parts[0]] = parts[1]
+	}
+	return vars, nil
+}
+
+// splitFields splits line by spaces like shell does, so quoted parts
+// like key='a b' stay in one field, with quotes removed
+func splitFields(line string) ([]string, error) {
+	fields := []string{}
+	field := strings.Builder{}
+	inField := false
+	quote := rune(0)
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == '\'':
+			field.WriteRune(r)
+		case r == '\\':
+			escaped, inField = true, true
+		case quote != 0:
+			field.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inField = r, true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+func (inv *ansibleInventory) readYAML(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	groups := root.Content[0]
+	if groups.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: groups mapping expected", groups.Line)
+	}
+	for i := 0; i+1 < len(groups.Content); i += 2 {
+		if err := inv.walkYAML(groups.Content[i].Value, groups.Content[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkYAML reads group with its hosts, vars and children
+func (inv *ansibleInventory) walkYAML(name string, group *yaml.Node) error {
+	inv.group(name)
+	if group.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(group.Content); i += 2 {
+		key, value := group.Content[i].Value, group.Content[i+1]
+		switch key {
+		case "hosts":
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				vars, err := decodeVars(value.Content[j+1])
+				if err != nil {
+					return err
+				}
+				if err := inv.addHosts(name, value.Content[j].Value, vars); err != nil {
+					return fmt.Errorf("line %d: %w", value.Content[j].Line, err)
+				}
+			}
+		case "vars":
+			vars, err := decodeVars(value)
+			if err != nil {
+				return err
+			}
+			inv.setGroupVars(name, vars)
+		case "children":
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				inv.addChild(name, value.Content[j].Value)
+				if err := inv.walkYAML(value.Content[j].Value, value.Content[j+1]); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func decodeVars(node *yaml.Node) (map[string]string, error) {
+	raw := map[string]interface{}{}
+	if err := node.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	vars := map[string]string{}
+	for key, value := range raw {
+		vars[key] = fmt.Sprint(value)
+	}
+	return vars, nil
+}
+
+func (inv *ansibleInventory) group(name string) {
+	if _, ok := inv.members[name]; !ok {
+		inv.members[name] = nil
+		inv.groupOrder = append(inv.groupOrder, name)
+	}
+}
+
+// addHosts adds host, or hosts of range like web[01:10], to group
+func (inv *ansibleInventory) addHosts(group, pattern string, vars map[string]string) error {
+	names := []string{pattern}
+	if ansibleRange.MatchString(pattern) {
+		var err error
+		names, err = config.ExpandAddresses(ansibleRange.ReplaceAllString(pattern, "[$1-$2]"))
+		if err != nil {
+			return err
+		}
+	}
+	inv.group(group)
+	for _, name := range names {
+		if _, ok := inv.hostVars[name]; !ok {
+			inv.hostVars[name] = map[string]string{}
+			inv.hostOrder = append(inv.hostOrder, name)
+		}
+		for key, value := range vars {
+			inv.hostVars[name][key] = value
+		}
+		if !contains(inv.members[group], name) {
+			inv.members[group] = append(inv.members[group], name)
+		}
+	}
+	return nil
+}
+
+func (inv *ansibleInventory) addChild(parent, child string) {
+	inv.group(parent)
+	inv.group(child)
+	if !contains(inv.children[parent], child) {
+		inv.children[parent] = append(inv.children[parent], child)
+	}
+}
+
+func (inv *ansibleInventory) setGroupVars(group string, vars map[string]string) {
+	inv.group(group)
+	if inv.groupVars[group] == nil {
+		inv.groupVars[group] = map[string]string{}
+	}
+	for key, value := range vars {
+		inv.groupVars[group][key] = value
+	}
+}
+
+// groups resolves children of groups and variables of hosts. Host
+// variables override variables of its groups, which override all:vars.
+func (inv *ansibleInventory) groups() ([]Group, error) {
+	groups := []Group{}
+	for _, name := range inv.groupOrder {
+		group := Group{Name: name}
+		for _, hostName := range inv.resolve(name, map[string]bool{}) {
+			host, err := inv.host(hostName)
+			if err != nil {
+				return nil, err
+			}
+			group.Hosts = append(group.Hosts, host)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// resolve returns hosts of the group and its children
+func (inv *ansibleInventory) resolve(group string, visited map[string]bool) []string {
+	if visited[group] {
+		return nil
+	}
+	visited[group] = true
+	hosts := append([]string{}, inv.members[group]...)
+	for _, child := range inv.children[group] {
+		for _, host := range inv.resolve(child, visited) {
+			if !contains(hosts, host) {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+func (inv *ansibleInventory) host(name string) (config.Host, error) {
+	vars := map[string]string{}
+	merge := func(from map[string]string) {
+		for key, value := range from {
+			vars[key] = value
+		}
+	}
+	merge(inv.groupVars["all"])
+	for _, group := range inv.groupOrder {
+		if group != "all" && contains(inv.resolve(group, map[string]bool{}), name) {
+			merge(inv.groupVars[group])
+		}
+	}
+	merge(inv.hostVars[name])
+
+	address := firstVar(vars, "ansible_host", "ansible_ssh_host")
+	if address == "" {
+		address = name
+	}
+	port := int64(0)
+	if value := firstVar(vars, "ansible_port", "ansible_ssh_port"); value != "" {
+		var err error
+		port, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return config.Host{}, fmt.Errorf("host %s: invalid port %q", name, value)
+		}
+	}
+	host := newHost(address, port, firstVar(vars, "ansible_user", "ansible_ssh_user"),
+		vars["ansible_ssh_private_key_file"])
+	host.AgentName = config.DefaultAgentName(name)
+	switch strings.ToLower(vars["ansible_become"]) {
+	case "true", "yes", "1":
+		host.Become = true
+	case "false", "no", "0":
+		host.Become = false
+	}
+	if method := vars["ansible_become_method"]; method != "" && host.Become {
+		host.BecomeMethod = method
+	}
+	return host, nil
+}
+
+func firstVar(vars map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value := vars[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
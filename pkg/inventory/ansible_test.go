@@ -0,0 +1,112 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+func TestLoadAnsibleINI(t *testing.T) {
+	path := writeFile(t, "hosts.ini", `
+# comment
+[masters]
+node1 ansible_host=10.0.0.1
+node[2:3].example.com ansible_port=2222
+
+[workers]
+10.0.1.1 ansible_user=ubuntu ansible_ssh_common_args='-o ProxyJump=x' ansible_become=false
+
+[workers:vars]
+ansible_ssh_private_key_file = "~/.ssh/my key"
+
+[cluster:children]
+masters
+workers
+
+[all:vars]
+ansible_user=ops
+`)
+	groups, err := Load("ansible", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node1 := config.Host{Address: "10.0.0.1", SshPort: 22, User: "ops", AgentName: "node1", Become: true}
+	node2 := config.Host{Address: "node2.example.com", SshPort: 2222, User: "ops", AgentName: "node2", Become: true}
+	node3 := config.Host{Address: "node3.example.com", SshPort: 2222, User: "ops", AgentName: "node3", Become: true}
+	worker := config.Host{Address: "10.0.1.1", SshPort: 22, User: "ubuntu", SSHKey: "~/.ssh/my key"}
+	checkGroups(t, groups, []Group{
+		{Name: "masters", Hosts: []config.Host{node1, node2, node3}},
+		{Name: "workers", Hosts: []config.Host{worker}},
+		{Name: "cluster", Hosts: []config.Host{node1, node2, node3, worker}},
+		{Name: "all"},
+	})
+}
+
+func TestLoadAnsibleINIErrors(t *testing.T) {
+	for _, content := range []string{
+		"[servers]\nnode1 ansible_host\n",
+		"[servers]\nnode1 ansible_ssh_common_args='-o ProxyJump=x\n",
+		"[servers:unknown]\nnode1\n",
+		"[servers]\nnode1 ansible_port=ssh\n",
+	} {
+		path := writeFile(t, "hosts", content)
+		if _, err := Load("ansible", path); err == nil {
+			t.Errorf("inventory %q is accepted", content)
+		}
+	}
+}
+
+func TestLoadAnsibleYAML(t *testing.T) {
+	path := writeFile(t, "hosts.yml", `
+all:
+  vars:
+    ansible_user: ops
+  children:
+    servers:
+      hosts:
+        server1:
+          ansible_host: 10.0.0.1
+          ansible_become: no
+    clients:
+      hosts:
+        client[1:2].example.com:
+          ansible_port: 2200
+      vars:
+        ansible_user: root
+`)
+	groups, err := Load("ansible", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := config.Host{Address: "10.0.0.1", SshPort: 22, User: "ops", AgentName: "server1"}
+	client1 := config.Host{Address: "client1.example.com", SshPort: 2200, User: "root", AgentName: "client1"}
+	client2 := config.Host{Address: "client2.example.com", SshPort: 2200, User: "root", AgentName: "client2"}
+	checkGroups(t, groups, []Group{
+		{Name: "all", Hosts: []config.Host{server, client1, client2}},
+		{Name: "servers", Hosts: []config.Host{server}},
+		{Name: "clients", Hosts: []config.Host{client1, client2}},
+	})
+}
+
+func TestSplitFields(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "node1  a=1\tb=2", want: []string{"node1", "a=1", "b=2"}},
+		{line: `a='-o ProxyJump=x' b="c d"`, want: []string{"a=-o ProxyJump=x", "b=c d"}},
+		{line: `a="it's" b='say "hi"'`, want: []string{"a=it's", `b=say "hi"`}},
+		{line: `a=one\ two b=''`, want: []string{"a=one two", "b="}},
+	}
+	for _, tt := range tests {
+		got, err := splitFields(tt.line)
+		if err != nil {
+			t.Errorf("splitFields(%q) error = %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitFields(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
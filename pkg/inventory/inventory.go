@@ -0,0 +1,206 @@
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// Group is a named group of hosts of foreign inventory
+type Group struct {
+	Name  string
+	Hosts []config.Host
+}
+
+// Mapping lists inventory groups whose hosts become servers or clients
+type Mapping struct {
+	Servers []string
+	Clients []string
+}
+
+// DefaultMapping matches conventional group names
+var DefaultMapping = Mapping{
+	Servers: []string{"servers", "server", "consul_servers", "nomad_servers"},
+	Clients: []string{"clients", "client", "consul_clients", "nomad_clients"},
+}
+
+// ParseMapping parses role=group pairs like server=masters, which
+// replace default groups of the role
+func ParseMapping(pairs []string) (Mapping, error) {
+	mapping := DefaultMapping
+	servers, clients := []string{}, []string{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return Mapping{}, fmt.Errorf("invalid group mapping %q, expected role=group", pair)
+		}
+		switch parts[0] {
+		case "server":
+			servers = append(servers, parts[1])
+		case "client":
+			clients = append(clients, parts[1])
+		default:
+			return Mapping{}, fmt.Errorf("unknown role %q in group mapping, expected server or client", parts[0])
+		}
+	}
+	if len(servers) > 0 {
+		mapping.Servers = servers
+	}
+	if len(clients) > 0 {
+		mapping.Clients = clients
+	}
+	return mapping, nil
+}
+
+// Load reads inventory of the format, which is one of ansible,
+// terraform or vagrant
+func Load(format, path string) ([]Group, error) {
+	switch format {
+	case "ansible":
+		return loadAnsible(path)
+	case "terraform":
+		return loadTerraform(path)
+	case "vagrant":
+		return loadVagrant(path)
+	default:
+		return nil, fmt.Errorf("unknown inventory format %q, expected ansible, terraform or vagrant", format)
+	}
+}
+
+// Apply replaces hosts of the config with hosts of mapped groups.
+// Host in both server and client groups becomes server. Hosts are
+// named as in inventory, unnamed ones get remote hostnames on deploy.
+// Hosts already in config, found by agent name or address, keep their
+// name, labels, node class and metadata set there.
+func Apply(c *config.Config, groups []Group, mapping Mapping) error {
+	servers := hostsOf(groups, mapping.Servers, nil)
+	if len(servers) == 0 {
+		return fmt.Errorf("no hosts in server groups %s, inventory has groups %s",
+			strings.Join(mapping.Servers, ", "), strings.Join(names(groups), ", "))
+	}
+	clients := hostsOf(groups, mapping.Clients, servers)
+
+	existing := c.AllHosts()
+	c.Servers, c.Clients = merge(servers, existing), merge(clients, existing)
+	return nil
+}
+
+// merge returns imported hosts with settings of the same hosts in
+// existing config, which take precedence over inventory ones
+func merge(imported, existing []config.Host) []config.Host {
+	for i, host := range imported {
+		old, ok := find(existing, host)
+		if !ok {
+			continue
+		}
+		if host.AgentName == "" {
+			host.AgentName = old.AgentName
+		}
+		if old.NodeClass != "" {
+			host.NodeClass = old.NodeClass
+		}
+		host.Labels = mergeMaps(host.Labels, old.Labels)
+		host.NodeMeta = mergeMaps(host.NodeMeta, old.NodeMeta)
+		host.ConsulNodeMeta = mergeMaps(host.ConsulNodeMeta, old.ConsulNodeMeta)
+		imported[i] = host
+	}
+	return imported
+}
+
+// find returns existing host of the same agent name, or of the same
+// address if there is none
+func find(existing []config.Host, host config.Host) (config.Host, bool) {
+	if host.AgentName != "" {
+		for _, old := range existing {
+			if old.AgentName == host.AgentName {
+				return old, true
+			}
+		}
+	}
+	for _, old := range existing {
+		if hostKey(old) == hostKey(host) {
+			return old, true
+		}
+	}
+	return config.Host{}, false
+}
+
+// mergeMaps returns new map of imported values overridden by user ones
+func mergeMaps(imported, user map[string]string) map[string]string {
+	if len(imported) == 0 && len(user) == 0 {
+		return imported
+	}
+	merged := map[string]string{}
+	for key, value := range imported {
+		merged[key] = value
+	}
+	for key, value := range user {
+		merged[key] = value
+	}
+	return merged
+}
+
+// hostsOf returns hosts of named groups in inventory order, skipping
+// duplicates and hosts already in exclude
+func hostsOf(groups []Group, names []string, exclude []config.Host) []config.Host {
+	seen := map[string]bool{}
+	for _, host := range exclude {
+		seen[hostKey(host)] = true
+	}
+	hosts := []config.Host{}
+	for _, group := range groups {
+		if !contains(names, group.Name) {
+			continue
+		}
+		for _, host := range group.Hosts {
+			if !seen[hostKey(host)] {
+				seen[hostKey(host)] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+func hostKey(host config.Host) string {
+	return fmt.Sprintf("%s:%d", host.Address, host.SshPort)
+}
+
+func names(groups []Group) []string {
+	result := []string{}
+	for _, group := range groups {
+		result = append(result, group.Name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newHost returns host with default port and user, non-root users
+// get sudo. Host is named after its address if it is a hostname.
+func newHost(address string, port int64, user, sshKey string) config.Host {
+	if port == 0 {
+		port = 22
+	}
+	if user == "" {
+		user = "root"
+	}
+	return config.Host{
+		Address:   address,
+		SshPort:   port,
+		User:      user,
+		AgentName: config.DefaultAgentName(address),
+		SSHKey:    sshKey,
+		Become:    user != "root",
+	}
+}
@@ -0,0 +1,101 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// writeFile writes inventory into temporary directory of the test
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// checkGroups compares loaded groups with expected ones
+func checkGroups(t *testing.T, got, want []Group) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %+v, want %+v", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	groups := []Group{
+		{Name: "masters", Hosts: []config.Host{
+			{Address: "10.0.0.1", SshPort: 22, User: "root", AgentName: "m1"},
+		}},
+		{Name: "workers", Hosts: []config.Host{
+			{Address: "10.0.0.1", SshPort: 22, User: "root", AgentName: "m1"},
+			{Address: "10.0.0.2", SshPort: 22, User: "root", AgentName: "w1"},
+		}},
+	}
+	mapping, err := ParseMapping([]string{"server=masters", "client=workers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &config.Config{DCName: "dc1"}
+	if err := Apply(c, groups, mapping); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Servers) != 1 || c.Servers[0].AgentName != "m1" {
+		t.Errorf("servers = %+v, want m1 only", c.Servers)
+	}
+	if len(c.Clients) != 1 || c.Clients[0].AgentName != "w1" {
+		t.Errorf("clients = %+v, want w1 only", c.Clients)
+	}
+}
+
+func TestApplyKeepsUserSettings(t *testing.T) {
+	c := &config.Config{
+		DCName: "dc1",
+		Servers: []config.Host{
+			{Address: "10.0.0.1", SshPort: 22, User: "root", AgentName: "m1", Labels: map[string]string{"zone": "a"}},
+		},
+		Clients: []config.Host{
+			{
+				Address: "10.0.0.2", SshPort: 22, User: "root", AgentName: "worker-2",
+				NodeClass: "gpu", NodeMeta: map[string]string{"rack": "r1"},
+				ConsulNodeMeta: map[string]string{"team": "infra"},
+			},
+			{Address: "10.0.0.9", SshPort: 22, User: "root", AgentName: "gone"},
+		},
+	}
+	groups := []Group{
+		{Name: "servers", Hosts: []config.Host{
+			{Address: "10.0.0.1", SshPort: 22, User: "ops", AgentName: "m1", Labels: map[string]string{"zone": "b", "disk": "ssd"}},
+		}},
+		{Name: "clients", Hosts: []config.Host{
+			{Address: "10.0.0.2", SshPort: 22, User: "ops"},
+			{Address: "10.0.0.3", SshPort: 22, User: "ops"},
+		}},
+	}
+	if err := Apply(c, groups, DefaultMapping); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := []config.Host{
+		{Address: "10.0.0.1", SshPort: 22, User: "ops", AgentName: "m1", Labels: map[string]string{"zone": "a", "disk": "ssd"}},
+	}
+	clients := []config.Host{
+		{
+			Address: "10.0.0.2", SshPort: 22, User: "ops", AgentName: "worker-2",
+			NodeClass: "gpu", NodeMeta: map[string]string{"rack": "r1"},
+			ConsulNodeMeta: map[string]string{"team": "infra"},
+		},
+		{Address: "10.0.0.3", SshPort: 22, User: "ops"},
+	}
+	if !reflect.DeepEqual(c.Servers, servers) {
+		t.Errorf("servers = %+v, want %+v", c.Servers, servers)
+	}
+	if !reflect.DeepEqual(c.Clients, clients) {
+		t.Errorf("clients = %+v, want %+v", c.Clients, clients)
+	}
+}
@@ -0,0 +1,125 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// terraformOutput is an output of `terraform output -json`
+type terraformOutput struct {
+	Value interface{} `json:"value"`
+}
+
+// loadTerraform reads `terraform output -json`, every output is a group.
+// Output value is an address, list of addresses, map of names to
+// addresses, or list of objects with address, name, port, user and
+// ssh_key.
+func loadTerraform(path string) ([]Group, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]terraformOutput{}
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	names := []string{}
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	groups := []Group{}
+	for _, name := range names {
+		hosts, err := terraformHosts(outputs[name].Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: output %s: %w", path, name, err)
+		}
+		groups = append(groups, Group{Name: name, Hosts: hosts})
+	}
+	return groups, nil
+}
+
+func terraformHosts(value interface{}) ([]config.Host, error) {
+	switch value := value.(type) {
+	case string:
+		return []config.Host{newHost(value, 0, "", "")}, nil
+	case []interface{}:
+		hosts := []config.Host{}
+		for _, item := range value {
+			host, err := terraformHost(item)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, host)
+		}
+		return hosts, nil
+	case map[string]interface{}:
+		// map of instance names to addresses, ordered by name
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		hosts := []config.Host{}
+		for _, key := range keys {
+			host, err := terraformHost(value[key])
+			if err != nil {
+				return nil, err
+			}
+			// instance is named by its key unless object names it
+			if item, ok := value[key].(map[string]interface{}); !ok || firstString(item, "name", "hostname") == "" {
+				host.AgentName = key
+			}
+			hosts = append(hosts, host)
+		}
+		return hosts, nil
+	default:
+		return nil, nil
+	}
+}
+
+func terraformHost(item interface{}) (config.Host, error) {
+	switch item := item.(type) {
+	case string:
+		return newHost(item, 0, "", ""), nil
+	case map[string]interface{}:
+		address := firstString(item, "address", "ip", "private_ip", "public_ip", "host")
+		if address == "" {
+			return config.Host{}, fmt.Errorf("no address in %v", item)
+		}
+		port := int64(0)
+		if value, ok := firstValue(item, "port", "ssh_port").(float64); ok {
+			port = int64(value)
+		}
+		host := newHost(address, port, firstString(item, "user", "ssh_user"), firstString(item, "ssh_key", "key"))
+		if name := firstString(item, "name", "hostname"); name != "" {
+			host.AgentName = config.DefaultAgentName(name)
+		}
+		return host, nil
+	default:
+		return config.Host{}, fmt.Errorf("unexpected host %v", item)
+	}
+}
+
+func firstValue(object map[string]interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		if value, ok := object[key]; ok && value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+func firstString(object map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := object[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
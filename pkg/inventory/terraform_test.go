@@ -0,0 +1,45 @@
+package inventory
+
+import (
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+func TestLoadTerraform(t *testing.T) {
+	path := writeFile(t, "output.json", `{
+  "bastion": {"sensitive": false, "type": "string", "value": "10.0.0.100"},
+  "clients": {"value": {"worker-b": "10.0.1.2", "worker-a": "10.0.1.1"}},
+  "servers": {"value": ["10.0.0.1", {"private_ip": "10.0.0.2", "name": "srv2.example.com", "port": 2222, "user": "ubuntu", "ssh_key": "~/.ssh/tf"}]}
+}`)
+	groups, err := Load("terraform", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGroups(t, groups, []Group{
+		{Name: "bastion", Hosts: []config.Host{
+			{Address: "10.0.0.100", SshPort: 22, User: "root"},
+		}},
+		{Name: "clients", Hosts: []config.Host{
+			{Address: "10.0.1.1", SshPort: 22, User: "root", AgentName: "worker-a"},
+			{Address: "10.0.1.2", SshPort: 22, User: "root", AgentName: "worker-b"},
+		}},
+		{Name: "servers", Hosts: []config.Host{
+			{Address: "10.0.0.1", SshPort: 22, User: "root"},
+			{Address: "10.0.0.2", SshPort: 2222, User: "ubuntu", AgentName: "srv2", SSHKey: "~/.ssh/tf", Become: true},
+		}},
+	})
+}
+
+func TestLoadTerraformErrors(t *testing.T) {
+	for _, content := range []string{
+		`not json`,
+		`{"servers": {"value": [{"name": "no-address"}]}}`,
+		`{"servers": {"value": [42]}}`,
+	} {
+		path := writeFile(t, "output.json", content)
+		if _, err := Load("terraform", path); err == nil {
+			t.Errorf("output %s is accepted", content)
+		}
+	}
+}
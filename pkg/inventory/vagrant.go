@@ -0,0 +1,58 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+var (
+	vagrantDefine = regexp.MustCompile(`\.vm\.define\s+["':]([\w.-]+)`)
+	vagrantIP     = regexp.MustCompile(`\.vm\.network\s+["':]private_network["']?\s*,\s*:?ip(?::|\s*=>)\s*["']([^"']+)["']`)
+	// vagrantNumber is trailing machine number stripped to get its group
+	vagrantNumber = regexp.MustCompile(`[-_]?\d+$`)
+)
+
+// loadVagrant reads machines defined in Vagrantfile with their private
+// network addresses. Machines are grouped by name without trailing
+// number, so server-0 is in group server. Provisioning of the repo
+// Vagrantfile authorizes the key of root, so machines are connected
+// as root.
+func loadVagrant(path string) ([]Group, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content := string(data)
+
+	groups := []Group{}
+	defines := vagrantDefine.FindAllStringSubmatchIndex(content, -1)
+	for i, define := range defines {
+		name := content[define[2]:define[3]]
+		end := len(content)
+		if i+1 < len(defines) {
+			end = defines[i+1][0]
+		}
+		match := vagrantIP.FindStringSubmatch(content[define[1]:end])
+		if match == nil {
+			return nil, fmt.Errorf("%s: machine %s has no private network ip", path, name)
+		}
+
+		groupName := vagrantNumber.ReplaceAllString(name, "")
+		host := newHost(match[1], 0, "", "")
+		host.AgentName = name
+		found := false
+		for j := range groups {
+			if groups[j].Name == groupName {
+				groups[j].Hosts = append(groups[j].Hosts, host)
+				found = true
+			}
+		}
+		if !found {
+			groups = append(groups, Group{Name: groupName, Hosts: []config.Host{host}})
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,36 @@
+package inventory
+
+import (
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+func TestLoadVagrant(t *testing.T) {
+	groups, err := Load("vagrant", "../../Vagrantfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGroups(t, groups, []Group{
+		{Name: "server", Hosts: []config.Host{
+			{Address: "192.168.33.10", SshPort: 22, User: "root", AgentName: "server-0"},
+		}},
+		{Name: "client", Hosts: []config.Host{
+			{Address: "192.168.33.11", SshPort: 22, User: "root", AgentName: "client-0"},
+			{Address: "192.168.33.12", SshPort: 22, User: "root", AgentName: "client-1"},
+		}},
+	})
+}
+
+func TestLoadVagrantWithoutIP(t *testing.T) {
+	path := writeFile(t, "Vagrantfile", `
+Vagrant.configure("2") do |config|
+  config.vm.define "server-0" do |server|
+    server.vm.network "forwarded_port", guest: 4646, host: 4646
+  end
+end
+`)
+	if _, err := Load("vagrant", path); err == nil {
+		t.Error("machine without private network ip is accepted")
+	}
+}
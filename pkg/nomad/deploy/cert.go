@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/runlog"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
 )
 
@@ -30,93 +35,148 @@ func (c *Nomad) GenerateCertificates() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	currentDir, err := os.Getwd()
-	if err != nil {
-		return "", err
-	}
 
-	if err = os.Chdir(tempDir); err != nil {
-		return "", err
-	}
-
-	//create CA
-	createCaCmd := exec.Command(c.NomadBinPath, "tls", "ca", "create")
-	createCaCmd.Stderr = os.Stderr
-	if err = createCaCmd.Run(); err != nil {
-		return "", err
+	//create CA or use the one from config or previous deploy
+	caCertFile := filepath.Join(tempDir, "nomad-agent-ca.pem")
+	caKeyFile := filepath.Join(tempDir, "nomad-agent-ca-key.pem")
+	caCert, caKey := c.Cfg.Secrets.Nomad.CACert, c.Cfg.Secrets.Nomad.CAKey
+	if caCert == "" || caKey == "" {
+		caCert, caKey = c.Secrets.CACert, c.Secrets.CAKey
 	}
-
-	//create client certs
-	for range c.Cfg.Clients {
-		createClientCert := exec.Command(c.NomadBinPath, "tls", "cert", "create", "-client",
-			fmt.Sprintf("-dc=%s", c.Cfg.DCName))
-		createClientCert.Stderr = os.Stderr
-		if err = createClientCert.Run(); err != nil {
+	if caCert != "" && caKey != "" {
+		if err = os.WriteFile(caCertFile, []byte(caCert+"\n"), 0644); err != nil {
 			return "", err
 		}
-	}
-
-	//create server certs
-	for range c.Cfg.Servers {
-		createServerCert := exec.Command(c.NomadBinPath, "tls", "cert", "create", "-server",
-			fmt.Sprintf("-dc=%s", c.Cfg.DCName))
-		createServerCert.Stderr = os.Stderr
-		if err = createServerCert.Run(); err != nil {
+		if err = os.WriteFile(caKeyFile, []byte(caKey+"\n"), 0600); err != nil {
 			return "", err
 		}
+	} else {
+		createCaCmd := exec.Command(c.NomadBinPath, "tls", "ca", "create")
+		createCaCmd.Dir = tempDir
+		createCaCmd.Stderr = os.Stderr
+		if err = createCaCmd.Run(); err != nil {
+			return "", err
+		}
+		caCert, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return "", err
+		}
+		caKey, err := ioutil.ReadFile(caKeyFile)
+		if err != nil {
+			return "", err
+		}
+		c.Secrets.CACert, c.Secrets.CAKey = string(caCert), string(caKey)
 	}
 
-	if err = os.Chdir(currentDir); err != nil {
-		return "", err
+	//create certificate of every agent
+	for _, host := range c.Cfg.AllHosts() {
+		if err = c.createCert(tempDir, host); err != nil {
+			return "", err
+		}
 	}
 	return tempDir, nil
 }
 
-func (c *Nomad) DeployCertificates(certsDir string) error {
-	findFiles := func(dir string, pattern string) ([]string, error) {
-		files := []string{}
-		err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-			if strings.Contains(f.Name(), pattern) {
-				files = append(files, path)
-			}
-			return nil
-		})
-		return files, err
+// createCert creates certificate of the host signed by CA in dir and
+// names it after the agent, so naming doesn't depend on host order
+func (c *Nomad) createCert(dir string, host config.Host) error {
+	hostDir, err := ioutil.TempDir(dir, host.AgentName)
+	if err != nil {
+		return err
 	}
-	for _, host := range c.Cfg.Clients {
-		certs, err := findFiles(certsDir, "client")
-		if err != nil {
+	defer os.RemoveAll(hostDir)
+
+	// nomad CLI on the host talks to the agent by its address,
+	// so the address must be valid for the certificate
+	addressFlag := "-additional-dnsname=" + host.Address
+	if net.ParseIP(host.Address) != nil {
+		addressFlag = "-additional-ipaddress=" + host.Address
+	}
+	createCert := exec.Command(c.NomadBinPath, "tls", "cert", "create", "-"+c.Cfg.Role(host),
+		addressFlag,
+		"-ca="+filepath.Join(dir, "nomad-agent-ca.pem"),
+		"-key="+filepath.Join(dir, "nomad-agent-ca-key.pem"))
+	createCert.Dir = hostDir
+	createCert.Stderr = os.Stderr
+	if err = createCert.Run(); err != nil {
+		return err
+	}
+
+	created, err := filepath.Glob(filepath.Join(hostDir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	certFile, keyFile := c.certFiles(host)
+	for _, file := range created {
+		target := certFile
+		if strings.HasSuffix(file, "-key.pem") {
+			target = keyFile
+		}
+		if err = os.Rename(file, filepath.Join(dir, target)); err != nil {
 			return err
 		}
-		for _, cert := range append(certs, filepath.Join(certsDir, "nomad-agent-ca.pem")) {
-			err = ssh.Scp(host, c.Cfg, cert, "/etc/nomad.d/")
-			if err != nil {
-				return err
-			}
+	}
+	return nil
+}
+
+// certFiles returns names of certificate and key files of the host
+func (c *Nomad) certFiles(host config.Host) (string, string) {
+	base := fmt.Sprintf("%s-%s-nomad-%s", c.Cfg.DCName, c.Cfg.Role(host), host.AgentName)
+	return base + ".pem", base + "-key.pem"
+}
+
+// DeployCertificates copies CA certificate and certificate of the host
+// generated in certsDir on the host
+func (c *Nomad) DeployCertificates(host config.Host, certsDir string) error {
+	certFile, keyFile := c.certFiles(host)
+	files := map[string]os.FileMode{
+		"nomad-agent-ca.pem": ssh.ModeConfig,
+		certFile:             ssh.ModeConfig,
+		keyFile:              ssh.ModeSecret,
+	}
+	for name, mode := range files {
+		if err := c.upload(host, filepath.Join(certsDir, name), path.Join("/etc/nomad.d", name), mode); err != nil {
+			return err
 		}
 	}
-	for _, host := range c.Cfg.Servers {
-		certs, err := findFiles(certsDir, "server")
+	return nil
+}
+
+// BootstrapACL bootstraps ACL system on the first server and keeps
+// the bootstrap token in secrets
+func (c *Nomad) BootstrapACL() error {
+	// ACL system can be bootstrapped only once, so token of
+	// previous deploy is kept in secrets file
+	if c.Cfg.Secrets.Nomad.ACLToken != "" {
+		log.Println("ACL token is taken from config, skipping bootstrap")
+		return nil
+	}
+	if c.Secrets.BootstrapToken == "" {
+		command, opts := c.cli(c.Cfg.Servers[0], "nomad acl bootstrap", ssh.Options{})
+		output, err := ssh.SshWith(c.Cfg.Servers[0], c.Cfg, command, opts)
 		if err != nil {
 			return err
 		}
-		for _, cert := range append(certs, filepath.Join(certsDir, "nomad-agent-ca.pem")) {
-			err = ssh.Scp(host, c.Cfg, cert, "/etc/nomad.d/")
-			if err != nil {
-				return err
-			}
-		}
+		c.Secrets.BootstrapToken = secretID(output)
+		runlog.Redact(c.Secrets.BootstrapToken)
+		log.Println("ACL bootstrap token is saved to secrets file, see `nomad-deploy secrets show`")
 	}
-
 	return nil
 }
 
-func (c *Nomad) PrintBootstrapTokenInfo() error {
-	output, err := ssh.Ssh(c.Cfg.Servers[0], c.Cfg, "nomad acl bootstrap")
-	if err != nil {
-		return err
+// secretID extracts secret part of token from output of
+// acl bootstrap command
+func secretID(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ':' || r == '=' || r == ' ' || r == '\t'
+		})
+		if len(fields) == 2 && fields[0] == "SecretID" {
+			return fields[1]
+		}
+		if len(fields) == 3 && fields[0] == "Secret" && fields[1] == "ID" {
+			return fields[2]
+		}
 	}
-	fmt.Println("Your bootstrapped ACL token:")
-	fmt.Println(output)
-	return nil
+	return strings.TrimSpace(output)
 }
@@ -8,19 +8,29 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"regexp"
 	"strings"
 
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/rollback"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
 )
 
 //go:embed templates
 var templates embed.FS
 
+// Templates are config and unit file templates deployed on hosts
+var Templates fs.FS = templates
+
 type Nomad struct {
 	NomadBinPath string
 	Cfg          *config.Config
 	Templates    fs.FS
+	State        *state.Component
+	Secrets      *secrets.Component
 }
 
 func NewDeployer(Cfg *config.Config) (*Nomad, error) {
@@ -91,31 +101,56 @@ func unzip(zipFile string) (string, error) {
 	return result.Name(), nil
 }
 
-func (c *Nomad) DeployBinary() error {
-	allHosts := append(c.Cfg.Clients, c.Cfg.Servers...)
-	for _, host := range allHosts {
-		// check if binary already exists
-		bins, err := ssh.Ssh(host, c.Cfg, "ls /usr/local/bin/")
+// DeployBinary copies nomad binary on the host, unless it is
+// already there
+func (c *Nomad) DeployBinary(host config.Host) error {
+	bins, err := ssh.SshRetry(host, c.Cfg, "ls /usr/local/bin/")
+	if err != nil {
+		return err
+	}
+	if strings.Contains(bins, "nomad") {
+		// binary is kept, but state records which version it is
+		output, err := ssh.SshRetry(host, c.Cfg, "/usr/local/bin/nomad version")
 		if err != nil {
 			return err
 		}
-		if strings.Contains(bins, "nomad") {
-			continue
+		version := installedVersion(output)
+		c.State.Host(c.Cfg, host).BinaryVersion = version
+		if c.State.BinaryVersion == "" {
+			c.State.BinaryVersion = version
 		}
+		return nil
+	}
 
-		if err := ssh.Scp(host, c.Cfg, c.NomadBinPath, "/usr/local/bin/nomad"); err != nil {
-			return err
-		}
+	if err := c.upload(host, c.NomadBinPath, "/usr/local/bin/nomad", ssh.ModeBinary); err != nil {
+		return err
 	}
+	c.State.Host(c.Cfg, host).BinaryVersion = c.Cfg.BinaryVersion
+	c.State.BinaryVersion = c.Cfg.BinaryVersion
 	return nil
 }
 
-// CreateDir creates remote directory with specified path
-func (c *Nomad) CreateDir(dirpath string) error {
-	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		if _, err := ssh.Ssh(host, c.Cfg, fmt.Sprintf("mkdir -p %s", dirpath)); err != nil {
-			return err
-		}
+// versionLine matches the first line of `nomad version` output
+var versionLine = regexp.MustCompile(`(?m)^Nomad v(\S+)`)
+
+// installedVersion returns version from output of `nomad version`,
+// which starts with line like "Nomad v1.2.3"
+func installedVersion(output string) string {
+	match := versionLine.FindStringSubmatch(output)
+	if match == nil {
+		return ""
 	}
-	return nil
+	return match[1]
+}
+
+// CreateDir creates remote directory with specified path
+func (c *Nomad) CreateDir(host config.Host, dirpath string) error {
+	_, err := ssh.SshRetry(host, c.Cfg, fmt.Sprintf("mkdir -p %s", dirpath))
+	return err
+}
+
+// upload replaces remote file backing up its previous version
+// for rollback
+func (c *Nomad) upload(host config.Host, localPath, remotePath string, mode os.FileMode) error {
+	return rollback.Upload(host, c.Cfg, c.State.Host(c.Cfg, host), localPath, remotePath, mode)
 }
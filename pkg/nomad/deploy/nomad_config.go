@@ -1,40 +1,55 @@
 package deploy
 
 import (
+	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"text/template"
 
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
 )
 
 // DeployBaseConfig deploys common between client and server agents
-// configuration on hosts
-func (c *Nomad) DeployBaseConfig() error {
+// configuration on the host
+func (c *Nomad) DeployBaseConfig(host config.Host) error {
+	tmp, err := ioutil.TempFile("", "nomad.hcl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err = c.writeBaseConfig(host, tmp); err != nil {
+		return err
+	}
+	return c.upload(host, tmp.Name(), "/etc/nomad.d/nomad.hcl", ssh.ModeConfig)
+}
+
+// writeBaseConfig renders common config of the host, enabling TLS
+// and ACL when they are enabled in config
+func (c *Nomad) writeBaseConfig(host config.Host, w io.Writer) error {
 	tpl, err := template.New("nomad.hcl").ParseFS(c.Templates, "templates/nomad.hcl")
 	if err != nil {
 		return err
 	}
-	for _, host := range c.Cfg.AllHosts() {
-		tmp, err := ioutil.TempFile("", "nomad.hcl")
-		if err != nil {
-			return err
-		}
-		defer os.Remove(tmp.Name())
-		tpl.Execute(tmp, map[string]string{
-			"DCName":  c.Cfg.DCName,
-			"Address": host.Address,
-		})
-		if err := ssh.Scp(host, c.Cfg, tmp.Name(), "/etc/nomad.d/nomad.hcl"); err != nil {
-			return err
-		}
+	parameters := map[string]string{
+		"DCName":  c.Cfg.DCName,
+		"Address": host.Address,
 	}
-	return nil
+	if c.Cfg.ACLEnabled {
+		parameters["ACLEnabled"] = "true"
+	}
+	if c.Cfg.TLSEnabled {
+		parameters["CACertFile"] = "nomad-agent-ca.pem"
+		parameters["CertFile"], parameters["KeyFile"] = c.certFiles(host)
+	}
+	return tpl.Execute(w, parameters)
 }
 
 // DeployServerConfig deploys server-only part of configuration
-// on all server hosts
-func (c *Nomad) DeployServerConfig() error {
+// on the server host
+func (c *Nomad) DeployServerConfig(host config.Host) error {
 	tpl, err := template.New("nomad-server.hcl").ParseFS(templates, "templates/nomad-server.hcl")
 	if err != nil {
 		return err
@@ -43,42 +58,48 @@ func (c *Nomad) DeployServerConfig() error {
 	if err != nil {
 		return err
 	}
-	gossipKey, err := c.GenerateGossipKey()
-	if err != nil {
-		return err
-	}
 	defer os.Remove(tmp.Name())
-	tpl.Execute(tmp, map[string]string{
-		"GossipKey": gossipKey,
-	})
-	for _, host := range c.Cfg.Servers {
-		if err := ssh.Scp(host, c.Cfg, tmp.Name(), "/etc/nomad.d/nomad-server.hcl"); err != nil {
+	defer tmp.Close()
+	gossipKey := c.Cfg.Secrets.Nomad.GossipKey
+	if gossipKey == "" && c.Secrets.GossipKey == "" {
+		c.Secrets.GossipKey, err = c.GenerateGossipKey()
+		if err != nil {
 			return err
 		}
 	}
-	return nil
+	if gossipKey == "" {
+		gossipKey = c.Secrets.GossipKey
+	}
+	err = tpl.Execute(tmp, map[string]string{
+		"GossipKey": gossipKey,
+	})
+	if err != nil {
+		return err
+	}
+	return c.upload(host, tmp.Name(), "/etc/nomad.d/nomad-server.hcl", ssh.ModeConfig)
 }
 
 // DeployClientConfig deploys client-only part of configuration
-// on all client hosts
-func (c *Nomad) DeployClientConfig() error {
+// on the client host
+func (c *Nomad) DeployClientConfig(host config.Host) error {
 	tmp, err := ioutil.TempFile("", "nomad-client.hcl")
 	if err != nil {
 		return err
 	}
 	defer os.Remove(tmp.Name())
-	rawConfig, err := templates.ReadFile("templates/nomad-client.hcl")
+	defer tmp.Close()
+	tpl, err := template.New("nomad-client.hcl").ParseFS(c.Templates, "templates/nomad-client.hcl")
 	if err != nil {
 		return err
 	}
-	_, err = tmp.Write(rawConfig)
-	if err != nil {
-		return err
+	parameters := map[string]interface{}{
+		"Meta": config.HCLAttributes(host.NodeMeta),
 	}
-	for _, host := range c.Cfg.Clients {
-		if err := ssh.Scp(host, c.Cfg, tmp.Name(), "/etc/nomad.d/nomad-client.hcl"); err != nil {
-			return err
-		}
+	if host.NodeClass != "" {
+		parameters["NodeClass"] = strconv.Quote(host.NodeClass)
+	}
+	if err := tpl.Execute(tmp, parameters); err != nil {
+		return err
 	}
-	return nil
+	return c.upload(host, tmp.Name(), "/etc/nomad.d/nomad-client.hcl", ssh.ModeConfig)
 }
@@ -1,14 +1,103 @@
 package deploy
 
-import "gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
 
-// DeleteSystemd deletes systemd service file
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/runlog"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+// drainMargin is time given to drain command after drain deadline
+// to notice remaining allocations are stopped
+const drainMargin = 30 * time.Second
+
+// Drain enables drain on every client node and waits until all
+// allocations are migrated or timeout expires
+func (c *Nomad) Drain(timeout time.Duration) error {
+	for _, host := range c.Cfg.Clients {
+		log.Printf("Draining %s (%s)\n", host.AgentName, host.Address)
+		// drain deadline forces remaining allocations to stop, extra
+		// time lets command notice that before being killed, and ssh
+		// waits for the command a bit longer still
+		command := fmt.Sprintf("timeout %d nomad node drain -self -enable -yes -deadline %s",
+			int((timeout + drainMargin).Seconds()), timeout)
+		command, opts := c.cli(host, command, ssh.Options{Timeout: timeout + 2*drainMargin})
+		if _, err := ssh.SshWith(host, c.Cfg, command, opts); err != nil {
+			return fmt.Errorf("failed to drain %s (%s): %w", host.AgentName, host.Address, err)
+		}
+	}
+	return nil
+}
+
+// LeaveServers stops servers one by one, forcing each of them to
+// leave raft peers from the last server remaining
+func (c *Nomad) LeaveServers(timeout time.Duration) error {
+	if len(c.Cfg.Servers) == 0 {
+		return nil
+	}
+	last := c.Cfg.Servers[len(c.Cfg.Servers)-1]
+	for _, host := range c.Cfg.Servers[:len(c.Cfg.Servers)-1] {
+		log.Printf("Removing server %s (%s) from cluster\n", host.AgentName, host.Address)
+		if _, err := ssh.SshRetry(host, c.Cfg, "systemctl stop nomad"); err != nil {
+			return err
+		}
+		command := fmt.Sprintf("timeout %d nomad server force-leave %s.global",
+			int(timeout.Seconds()), host.AgentName)
+		command, opts := c.cli(last, command, ssh.Options{})
+		if _, err := ssh.SshWith(last, c.Cfg, command, opts); err != nil {
+			return fmt.Errorf("failed to remove server %s (%s): %w", host.AgentName, host.Address, err)
+		}
+	}
+	return nil
+}
+
+// cli returns nomad CLI command run on the host against its agent,
+// which listens on host address only, and options of the command. ACL
+// token is passed on stdin rather than command line, where any user
+// of the host could see it.
+func (c *Nomad) cli(host config.Host, command string, opts ssh.Options) (string, ssh.Options) {
+	command = fmt.Sprintf("NOMAD_ADDR=%s %s", c.addr(host), command)
+	if c.Cfg.TLSEnabled {
+		command = "NOMAD_CACERT=/etc/nomad.d/nomad-agent-ca.pem " + command
+	}
+	if token := c.token(); token != "" {
+		runlog.Redact(token)
+		command = "read -r NOMAD_TOKEN && export NOMAD_TOKEN && " + command
+		opts.Input = token + "\n"
+	}
+	return command, opts
+}
+
+// addr returns HTTP API address of agent on the host
+func (c *Nomad) addr(host config.Host) string {
+	scheme := "http"
+	if c.Cfg.TLSEnabled {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host.Address, "4646"))
+}
+
+// token returns ACL token from config or the bootstrapped one
+func (c *Nomad) token() string {
+	if c.Cfg.Secrets.Nomad.ACLToken != "" {
+		return c.Cfg.Secrets.Nomad.ACLToken
+	}
+	return c.Secrets.BootstrapToken
+}
+
+// DeleteSystemd deletes systemd service, snapshot timer and their files
 func (c *Nomad) DeleteSystemd() error {
 	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		_, err := ssh.Ssh(
+		_, err := ssh.SshRetry(
 			host,
 			c.Cfg,
-			"bash -c \"systemctl stop nomad; systemctl disable nomad; rm -f /etc/systemd/system/nomad.service\"")
+			"bash -c \"systemctl disable --now nomad-snapshot.timer; systemctl stop nomad; systemctl disable nomad; "+
+				"rm -f /etc/systemd/system/nomad.service /etc/systemd/system/nomad-snapshot.service "+
+				"/etc/systemd/system/nomad-snapshot.timer /etc/nomad.d/snapshot.env; systemctl daemon-reload\"")
 		if err != nil {
 			return err
 		}
@@ -19,7 +108,7 @@ func (c *Nomad) DeleteSystemd() error {
 // DeleteConfigs deletes configuration directory
 func (c *Nomad) DeleteConfigs() error {
 	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		_, err := ssh.Ssh(host, c.Cfg, "bash -c \"rm -rf /etc/nomad.d\"")
+		_, err := ssh.SshRetry(host, c.Cfg, "bash -c \"rm -rf /etc/nomad.d\"")
 		if err != nil {
 			return err
 		}
@@ -30,7 +119,7 @@ func (c *Nomad) DeleteConfigs() error {
 // DeleteData deletes data directory
 func (c *Nomad) DeleteData() error {
 	for _, host := range append(c.Cfg.Clients, c.Cfg.Servers...) {
-		_, err := ssh.Ssh(host, c.Cfg, "bash -c \"rm -rf /opt/nomad\"")
+		_, err := ssh.SshRetry(host, c.Cfg, "bash -c \"rm -rf /opt/nomad\"")
 		if err != nil {
 			return err
 		}
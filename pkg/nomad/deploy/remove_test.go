@@ -0,0 +1,29 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/secrets"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+func TestCLI(t *testing.T) {
+	host := config.Host{Address: "10.0.0.1"}
+	c := &Nomad{Cfg: &config.Config{TLSEnabled: true}, Secrets: &secrets.Component{}}
+	command, opts := c.cli(host, "nomad node status", ssh.Options{Idempotent: true})
+	expected := "NOMAD_CACERT=/etc/nomad.d/nomad-agent-ca.pem NOMAD_ADDR=https://10.0.0.1:4646 nomad node status"
+	if command != expected || opts.Input != "" || !opts.Idempotent {
+		t.Errorf("command without token %q %+v", command, opts)
+	}
+
+	c.Secrets.BootstrapToken = "secret-token"
+	command, opts = c.cli(host, "nomad node status", ssh.Options{})
+	if strings.Contains(command, "secret-token") {
+		t.Errorf("token is on command line: %s", command)
+	}
+	if !strings.HasPrefix(command, "read -r NOMAD_TOKEN && export NOMAD_TOKEN && ") || opts.Input != "secret-token\n" {
+		t.Errorf("token is not read from stdin: %q %+v", command, opts)
+	}
+}
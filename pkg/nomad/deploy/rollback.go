@@ -0,0 +1,46 @@
+package deploy
+
+import (
+	"fmt"
+	"log"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/rollback"
+)
+
+// Rollback restores files overwritten by the last deploy on every
+// touched host and restarts nomad there. Progress of rolled back
+// hosts is forgotten, so next deploy does them from scratch.
+func (c *Nomad) Rollback() error {
+	for _, host := range c.Cfg.AllHosts() {
+		h, ok := c.State.Hosts[host.AgentName]
+		if !ok || len(h.Backups) == 0 {
+			continue
+		}
+		log.Printf("Rolling back %s (%s)\n", host.AgentName, host.Address)
+		before := len(h.Backups)
+		err := rollback.Restore(host, c.Cfg, h, "nomad")
+		if len(h.Backups) < before {
+			// files of the host were restored, even if not all
+			h.Steps = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PruneBackups deletes files backed up by the last deploy on every
+// touched host, once they are not needed for rollback
+func (c *Nomad) PruneBackups() error {
+	for _, host := range c.Cfg.AllHosts() {
+		h, ok := c.State.Hosts[host.AgentName]
+		if !ok {
+			continue
+		}
+		if err := rollback.Prune(host, c.Cfg, h); err != nil {
+			return fmt.Errorf("%s (%s): %w", host.AgentName, host.Address, err)
+		}
+	}
+	return nil
+}
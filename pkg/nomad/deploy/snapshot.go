@@ -0,0 +1,153 @@
+package deploy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+)
+
+// SnapshotDir is where scheduled snapshots are kept on servers
+const SnapshotDir = "/opt/nomad-snapshots"
+
+// SaveSnapshot takes snapshot of cluster state on the first
+// server, verifies it and downloads it to localPath
+func (c *Nomad) SaveSnapshot(localPath string) error {
+	host, err := c.snapshotServer()
+	if err != nil {
+		return err
+	}
+	remotePath := fmt.Sprintf("/tmp/nomad-%d.snap", time.Now().Unix())
+	defer ssh.SshRetry(host, c.Cfg, fmt.Sprintf("rm -f %s", remotePath))
+
+	log.Printf("Saving snapshot on %s (%s)\n", host.AgentName, host.Address)
+	command, opts := c.cli(host, "nomad operator snapshot save "+remotePath, ssh.Options{})
+	if _, err := ssh.SshWith(host, c.Cfg, command, opts); err != nil {
+		return err
+	}
+	if err := c.inspectSnapshot(host, remotePath); err != nil {
+		return err
+	}
+	log.Printf("Downloading snapshot to %s\n", localPath)
+	return ssh.Download(host, c.Cfg, remotePath, localPath)
+}
+
+// RestoreSnapshot uploads local snapshot to the first server,
+// verifies it and restores cluster state from it
+func (c *Nomad) RestoreSnapshot(localPath string) error {
+	host, err := c.snapshotServer()
+	if err != nil {
+		return err
+	}
+	remotePath := fmt.Sprintf("/tmp/nomad-%d.snap", time.Now().Unix())
+	log.Printf("Uploading snapshot to %s (%s)\n", host.AgentName, host.Address)
+	if err := ssh.Scp(host, c.Cfg, localPath, remotePath, ssh.ModeSecret); err != nil {
+		return err
+	}
+	defer ssh.SshRetry(host, c.Cfg, fmt.Sprintf("rm -f %s", remotePath))
+
+	if err := c.inspectSnapshot(host, remotePath); err != nil {
+		return err
+	}
+	log.Println("Restoring snapshot")
+	command, opts := c.cli(host, "nomad operator snapshot restore "+remotePath, ssh.Options{})
+	_, err = ssh.SshWith(host, c.Cfg, command, opts)
+	return err
+}
+
+func (c *Nomad) inspectSnapshot(host config.Host, remotePath string) error {
+	command, opts := c.cli(host, "nomad operator snapshot inspect "+remotePath, ssh.Options{Idempotent: true})
+	output, err := ssh.SshWith(host, c.Cfg, command, opts)
+	if err != nil {
+		return fmt.Errorf("snapshot verification failed: %w", err)
+	}
+	fmt.Print(output)
+	return nil
+}
+
+func (c *Nomad) snapshotServer() (config.Host, error) {
+	if len(c.Cfg.Servers) == 0 {
+		return config.Host{}, errors.New("no servers in config")
+	}
+	return c.Cfg.Servers[0], nil
+}
+
+// ScheduleSnapshots installs systemd timer on every server, which
+// saves snapshot into SnapshotDir every interval (systemd calendar
+// expression) keeping only last keep of them
+func (c *Nomad) ScheduleSnapshots(interval string, keep int) error {
+	if keep < 1 {
+		return errors.New("at least one snapshot must be kept")
+	}
+	parameters := map[string]interface{}{
+		"Dir":        SnapshotDir,
+		"FirstStale": keep + 1,
+		"Interval":   interval,
+	}
+	files := map[string]string{
+		"nomad-snapshot.service": "/etc/systemd/system/nomad-snapshot.service",
+		"nomad-snapshot.timer":   "/etc/systemd/system/nomad-snapshot.timer",
+	}
+	tempDir, err := ioutil.TempDir("", "nomad-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	for name := range files {
+		tpl, err := template.New(name).ParseFS(c.Templates, "templates/"+name)
+		if err != nil {
+			return err
+		}
+		rendered := bytes.Buffer{}
+		if err := tpl.Execute(&rendered, parameters); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(tempDir, name), rendered.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+
+	for _, host := range c.Cfg.Servers {
+		log.Printf("Scheduling snapshots on %s (%s)\n", host.AgentName, host.Address)
+		// agent address differs between servers, so does environment
+		envFile := filepath.Join(tempDir, "snapshot.env")
+		if err := os.WriteFile(envFile, []byte(c.snapshotEnv(host)), 0600); err != nil {
+			return err
+		}
+		for name, remotePath := range files {
+			if err := ssh.Scp(host, c.Cfg, filepath.Join(tempDir, name), remotePath, ssh.ModeConfig); err != nil {
+				return err
+			}
+		}
+		if err := ssh.Scp(host, c.Cfg, envFile, "/etc/nomad.d/snapshot.env", ssh.ModeSecret); err != nil {
+			return err
+		}
+		_, err := ssh.SshRetry(host, c.Cfg,
+			"systemctl daemon-reload; systemctl enable --now nomad-snapshot.timer")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotEnv returns content of environment file of snapshot service
+// on the host
+func (c *Nomad) snapshotEnv(host config.Host) string {
+	env := fmt.Sprintf("NOMAD_ADDR=%s\n", c.addr(host))
+	if c.Cfg.TLSEnabled {
+		env += "NOMAD_CACERT=/etc/nomad.d/nomad-agent-ca.pem\n"
+	}
+	if token := c.token(); token != "" {
+		env += fmt.Sprintf("NOMAD_TOKEN=%s\n", token)
+	}
+	return env
+}
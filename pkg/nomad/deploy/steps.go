@@ -0,0 +1,98 @@
+package deploy
+
+import (
+	"os"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/pipeline"
+)
+
+// Steps returns deployment plan of nomad cluster
+func (c *Nomad) Steps() []pipeline.Step {
+	servers := func() []config.Host { return c.Cfg.Servers }
+	clients := func() []config.Host { return c.Cfg.Clients }
+	var certDir string
+	steps := []pipeline.Step{
+		{
+			Name:        "binary",
+			Description: "Deploying nomad binary to all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run:         c.DeployBinary,
+		},
+		{
+			Name:        "services",
+			Description: "Deploying systemd service file to all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run:         c.DeploySystemd,
+		},
+		{
+			Name:        "config-dir",
+			Description: "Create config directory on all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run: func(host config.Host) error {
+				return c.CreateDir(host, "/etc/nomad.d/")
+			},
+		},
+		{
+			Name:        "base-config",
+			Description: "Deploying common nomad config to all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run:         c.DeployBaseConfig,
+		},
+		{
+			Name:        "server-config",
+			Description: "Deploying server config to all servers",
+			Hosts:       servers,
+			Run:         c.DeployServerConfig,
+		},
+		{
+			Name:        "client-config",
+			Description: "Deploying client config to all clients",
+			Hosts:       clients,
+			Run:         c.DeployClientConfig,
+		},
+	}
+	if c.Cfg.TLSEnabled {
+		steps = append(steps, pipeline.Step{
+			Name:        "certificates",
+			Description: "Generating and deploying TLS certificates",
+			Hosts:       c.Cfg.AllHosts,
+			Once: func() (err error) {
+				certDir, err = c.GenerateCertificates()
+				return err
+			},
+			Run: func(host config.Host) error {
+				return c.DeployCertificates(host, certDir)
+			},
+			Cleanup: func() {
+				if certDir != "" {
+					os.RemoveAll(certDir)
+				}
+			},
+		})
+	}
+	steps = append(steps, []pipeline.Step{
+		{
+			Name:        "data-dir",
+			Description: "Creating data directories on all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run: func(host config.Host) error {
+				return c.CreateDir(host, "/opt/nomad/")
+			},
+		},
+		{
+			Name:        "start",
+			Description: "Enabling and starting nomad systemd services on all agents",
+			Hosts:       c.Cfg.AllHosts,
+			Run:         c.StartSystemd,
+		},
+	}...)
+	if c.Cfg.ACLEnabled {
+		steps = append(steps, pipeline.Step{
+			Name:        "acl-bootstrap",
+			Description: "Bootstrapping ACL system",
+			Once:        c.BootstrapACL,
+		})
+	}
+	return steps
+}
@@ -0,0 +1,100 @@
+package deploy
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+func stepNames(c *Nomad) []string {
+	names := []string{}
+	for _, step := range c.Steps() {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestSteps(t *testing.T) {
+	base := []string{"binary", "services", "config-dir", "base-config", "server-config", "client-config"}
+	tests := []struct {
+		name  string
+		tls   bool
+		acl   bool
+		steps []string
+	}{
+		{"plain", false, false, append(base, "data-dir", "start")},
+		{"tls", true, false, append(base, "certificates", "data-dir", "start")},
+		{"acl", false, true, append(base, "data-dir", "start", "acl-bootstrap")},
+		{"tls and acl", true, true, append(base, "certificates", "data-dir", "start", "acl-bootstrap")},
+	}
+	for _, test := range tests {
+		c := &Nomad{Cfg: &config.Config{TLSEnabled: test.tls, ACLEnabled: test.acl}}
+		if steps := stepNames(c); !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("%s: steps %v, expected %v", test.name, steps, test.steps)
+		}
+	}
+}
+
+func TestBaseConfig(t *testing.T) {
+	server := config.Host{Address: "10.0.0.1", AgentName: "server1"}
+	tests := []struct {
+		name    string
+		tls     bool
+		acl     bool
+		present []string
+		absent  []string
+	}{
+		{
+			name:    "plain",
+			present: []string{"http = false", "enabled = false", `bind_addr = "10.0.0.1"`},
+			absent:  []string{"cert_file"},
+		},
+		{
+			name: "tls",
+			tls:  true,
+			present: []string{
+				"http = true",
+				"rpc = true",
+				`ca_file = "/etc/nomad.d/nomad-agent-ca.pem"`,
+				`cert_file = "/etc/nomad.d/dc1-server-nomad-server1.pem"`,
+				`key_file = "/etc/nomad.d/dc1-server-nomad-server1-key.pem"`,
+				"verify_server_hostname = true",
+			},
+			absent: []string{"http = false"},
+		},
+		{
+			name:    "acl",
+			acl:     true,
+			present: []string{"enabled = true"},
+			absent:  []string{"enabled = false"},
+		},
+	}
+	for _, test := range tests {
+		c := &Nomad{
+			Cfg: &config.Config{
+				DCName:     "dc1",
+				TLSEnabled: test.tls,
+				ACLEnabled: test.acl,
+				Servers:    []config.Host{server},
+			},
+			Templates: templates,
+		}
+		out := bytes.Buffer{}
+		if err := c.writeBaseConfig(server, &out); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, s := range test.present {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s: config has no %q:\n%s", test.name, s, out.String())
+			}
+		}
+		for _, s := range test.absent {
+			if strings.Contains(out.String(), s) {
+				t.Errorf("%s: config has %q:\n%s", test.name, s, out.String())
+			}
+		}
+	}
+}
@@ -3,6 +3,16 @@ client {
     "docker.privileged.enabled" = "true"
   }
   enabled = true
+{{- if .NodeClass }}
+  node_class = {{ .NodeClass }}
+{{- end }}
+{{- if .Meta }}
+  meta {
+{{- range .Meta }}
+    {{ . }}
+{{- end }}
+  }
+{{- end }}
 }
 plugin "raw_exec" {
   config {
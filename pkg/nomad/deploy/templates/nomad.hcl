@@ -2,11 +2,20 @@ datacenter = "{{ .DCName }}"
 data_dir = "/opt/nomad"
 bind_addr = "{{ .Address }}"
 tls {
+{{- if .CertFile }}
+  http = true
+  rpc = true
+  ca_file = "/etc/nomad.d/{{ .CACertFile }}"
+  cert_file = "/etc/nomad.d/{{ .CertFile }}"
+  key_file = "/etc/nomad.d/{{ .KeyFile }}"
+  verify_server_hostname = true
+{{- else }}
   http = false
   rpc = false
   verify_server_hostname = false
+{{- end }}
   verify_https_client = false
 }
 acl = {
-  enabled = false
+  enabled = {{ if .ACLEnabled }}true{{ else }}false{{ end }}
 }
\ No newline at end of file
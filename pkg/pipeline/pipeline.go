@@ -0,0 +1,177 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"text/tabwriter"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/runlog"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+// Step is a named stage of deployment. Step either applies to
+// every host returned by Hosts via Run, or is done once for the
+// whole cluster via Once when Hosts is nil.
+type Step struct {
+	Name        string
+	Description string
+	Hosts       func() []config.Host
+	// Once is called before step is applied to hosts
+	Once func() error
+	Run  func(host config.Host) error
+	// Cleanup is called after step is applied to hosts, even on failure
+	Cleanup func()
+}
+
+// Options select which steps are run
+type Options struct {
+	// Resume skips steps and hosts completed by previous run
+	Resume bool
+	// FromStep skips all steps before the named one
+	FromStep string
+	// OnlyStep runs the named step only
+	OnlyStep string
+}
+
+// Pipeline runs steps one by one, recording per-host completion
+// into the state of the component
+type Pipeline struct {
+	Cfg       *config.Config
+	State     *state.State
+	Component string
+	Steps     []Step
+}
+
+// Run executes selected steps, saving state after every host
+func (p *Pipeline) Run(opts Options) error {
+	steps, err := p.selectSteps(opts)
+	if err != nil {
+		return err
+	}
+	component := p.State.Component(p.Component)
+	if !opts.Resume {
+		// fresh run forgets about progress of previous one
+		for _, step := range steps {
+			delete(component.Steps, step.Name)
+			for _, host := range component.Hosts {
+				delete(host.Steps, step.Name)
+			}
+		}
+	}
+
+	for i, step := range steps {
+		log.Printf("[%d/%d] %s\n", i+1, len(steps), step.Description)
+		runlog.SetStep(step.Name)
+		if err := p.runStep(step, component, opts.Resume); err != nil {
+			return fmt.Errorf("step %s failed: %w", step.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) runStep(step Step, component *state.Component, resume bool) error {
+	if step.Hosts == nil {
+		if _, done := component.Steps[step.Name]; resume && done {
+			log.Println("Already done, skipping")
+			return nil
+		}
+		if err := step.Once(); err != nil {
+			return err
+		}
+		component.MarkStep(step.Name)
+		return p.State.Save()
+	}
+
+	pending := []config.Host{}
+	for _, host := range step.Hosts() {
+		if resume && hostDone(component, host, step.Name) {
+			continue
+		}
+		pending = append(pending, host)
+	}
+	if len(pending) == 0 {
+		log.Println("Already done on all hosts, skipping")
+		return nil
+	}
+
+	if step.Cleanup != nil {
+		defer step.Cleanup()
+	}
+	if step.Once != nil {
+		if err := step.Once(); err != nil {
+			return err
+		}
+	}
+	for _, host := range pending {
+		if err := step.Run(host); err != nil {
+			return fmt.Errorf("%s (%s): %w", host.AgentName, host.Address, err)
+		}
+		component.Host(p.Cfg, host).MarkStep(step.Name)
+		if err := p.State.Save(); err != nil {
+			return err
+		}
+	}
+	component.MarkStep(step.Name)
+	return p.State.Save()
+}
+
+func (p *Pipeline) selectSteps(opts Options) ([]Step, error) {
+	if opts.FromStep != "" && opts.OnlyStep != "" {
+		return nil, fmt.Errorf("--from-step and --only-step can't be used together")
+	}
+	name := opts.FromStep
+	if opts.OnlyStep != "" {
+		name = opts.OnlyStep
+	}
+	if name == "" {
+		return p.Steps, nil
+	}
+
+	for i, step := range p.Steps {
+		if step.Name != name {
+			continue
+		}
+		if opts.OnlyStep != "" {
+			return p.Steps[i : i+1], nil
+		}
+		return p.Steps[i:], nil
+	}
+	return nil, fmt.Errorf("unknown step %q, see --list-steps", name)
+}
+
+// List writes the plan along with per-host progress of last run
+func (p *Pipeline) List(w io.Writer) error {
+	component := p.State.Component(p.Component)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTEP\tDESCRIPTION\tPROGRESS")
+	for i, step := range p.Steps {
+		progress := "pending"
+		if step.Hosts == nil {
+			if _, done := component.Steps[step.Name]; done {
+				progress = "done"
+			}
+		} else {
+			hosts := step.Hosts()
+			done := 0
+			for _, host := range hosts {
+				if hostDone(component, host, step.Name) {
+					done++
+				}
+			}
+			progress = fmt.Sprintf("%d/%d hosts", done, len(hosts))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", i+1, step.Name, step.Description, progress)
+	}
+	return tw.Flush()
+}
+
+func hostDone(component *state.Component, host config.Host, step string) bool {
+	h, ok := component.Hosts[host.AgentName]
+	if !ok {
+		return false
+	}
+	_, done := h.Steps[step]
+	return done
+}
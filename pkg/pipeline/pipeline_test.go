@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+// recorder builds pipeline of steps which record their calls
+type recorder struct {
+	calls []string
+	// fail makes run of the step on the host fail
+	fail map[string]string
+}
+
+func (r *recorder) hostStep(name string, hosts []config.Host) Step {
+	return Step{
+		Name:  name,
+		Hosts: func() []config.Host { return hosts },
+		Once: func() error {
+			r.calls = append(r.calls, name+":once")
+			return nil
+		},
+		Run: func(host config.Host) error {
+			r.calls = append(r.calls, name+":"+host.AgentName)
+			if r.fail[name] == host.AgentName {
+				return errors.New("failed")
+			}
+			return nil
+		},
+		Cleanup: func() {
+			r.calls = append(r.calls, name+":cleanup")
+		},
+	}
+}
+
+func (r *recorder) onceStep(name string) Step {
+	return Step{
+		Name: name,
+		Once: func() error {
+			r.calls = append(r.calls, name)
+			return nil
+		},
+	}
+}
+
+func newPipeline(t *testing.T, r *recorder) *Pipeline {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	st, err := state.Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		st.Close()
+		os.Chdir(wd)
+	})
+
+	hosts := []config.Host{{AgentName: "s1"}, {AgentName: "s2"}}
+	return &Pipeline{
+		Cfg:       &config.Config{Servers: hosts},
+		State:     st,
+		Component: "consul",
+		Steps: []Step{
+			r.onceStep("keygen"),
+			r.hostStep("binary", hosts),
+			r.hostStep("config", hosts),
+			r.onceStep("bootstrap"),
+		},
+	}
+}
+
+func TestSelectSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		calls []string
+		err   bool
+	}{
+		{
+			name: "all",
+			calls: []string{
+				"keygen",
+				"binary:once", "binary:s1", "binary:s2", "binary:cleanup",
+				"config:once", "config:s1", "config:s2", "config:cleanup",
+				"bootstrap",
+			},
+		},
+		{
+			name:  "from step",
+			opts:  Options{FromStep: "config"},
+			calls: []string{"config:once", "config:s1", "config:s2", "config:cleanup", "bootstrap"},
+		},
+		{
+			name:  "only step",
+			opts:  Options{OnlyStep: "binary"},
+			calls: []string{"binary:once", "binary:s1", "binary:s2", "binary:cleanup"},
+		},
+		{name: "unknown step", opts: Options{FromStep: "nope"}, err: true},
+		{name: "both", opts: Options{FromStep: "binary", OnlyStep: "config"}, err: true},
+	}
+	for _, test := range tests {
+		r := &recorder{}
+		err := newPipeline(t, r).Run(test.opts)
+		if (err != nil) != test.err {
+			t.Errorf("%s: error %v", test.name, err)
+		}
+		if !reflect.DeepEqual(r.calls, test.calls) {
+			t.Errorf("%s: calls %v, expected %v", test.name, r.calls, test.calls)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	r := &recorder{fail: map[string]string{"config": "s2"}}
+	p := newPipeline(t, r)
+	if err := p.Run(Options{}); err == nil {
+		t.Fatal("failing step succeeded")
+	}
+	// cleanup runs after failure too
+	expected := []string{
+		"keygen",
+		"binary:once", "binary:s1", "binary:s2", "binary:cleanup",
+		"config:once", "config:s1", "config:s2", "config:cleanup",
+	}
+	if !reflect.DeepEqual(r.calls, expected) {
+		t.Errorf("failed run calls %v, expected %v", r.calls, expected)
+	}
+
+	// resume skips done Once step, done step and done host
+	r.calls, r.fail = nil, nil
+	if err := p.Run(Options{Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"config:once", "config:s2", "config:cleanup", "bootstrap"}
+	if !reflect.DeepEqual(r.calls, expected) {
+		t.Errorf("resumed run calls %v, expected %v", r.calls, expected)
+	}
+
+	// resume of completed deploy does nothing
+	r.calls = nil
+	if err := p.Run(Options{Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.calls) != 0 {
+		t.Errorf("resume of completed run calls %v", r.calls)
+	}
+}
+
+func TestFreshRunClearsProgress(t *testing.T) {
+	r := &recorder{}
+	p := newPipeline(t, r)
+	if err := p.Run(Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.calls, r.fail = nil, map[string]string{"binary": "s1"}
+	if err := p.Run(Options{}); err == nil {
+		t.Fatal("failing step succeeded")
+	}
+	component := p.State.Component("consul")
+	if _, done := component.Steps["bootstrap"]; done {
+		t.Error("progress of steps not reached by fresh run is kept")
+	}
+	if _, done := component.Hosts["s2"].Steps["config"]; done {
+		t.Error("progress of hosts not reached by fresh run is kept")
+	}
+	if _, done := component.Steps["keygen"]; !done {
+		t.Error("progress of fresh run is not recorded")
+	}
+}
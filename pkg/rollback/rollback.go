@@ -0,0 +1,118 @@
+package rollback
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/ssh"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+const backupSuffix = ".nomad-deploy.bak"
+
+// Backup copies remote file aside before it is overwritten and
+// records that in the host state. Only the first backup of the
+// file is kept, so rollback restores version before the deploy.
+func Backup(host config.Host, cfg *config.Config, h *state.Host, path string) error {
+	for _, backup := range h.Backups {
+		if backup.Path == path {
+			return nil
+		}
+	}
+
+	backupPath := path + backupSuffix
+	output, err := ssh.SshRetry(host, cfg, backupCommand(path, backupPath))
+	if err != nil {
+		return err
+	}
+	backup := state.Backup{Path: path}
+	if strings.TrimSpace(output) == "existed" {
+		backup.Existed = true
+		backup.BackupPath = backupPath
+	}
+	h.Backups = append(h.Backups, backup)
+	return nil
+}
+
+// Upload backs up remote file and replaces it with the local one
+func Upload(host config.Host, cfg *config.Config, h *state.Host, localPath, remotePath string, mode os.FileMode) error {
+	if err := Backup(host, cfg, h, remotePath); err != nil {
+		return err
+	}
+	return ssh.Scp(host, cfg, localPath, remotePath, mode)
+}
+
+// Restore stops the service, puts back all files backed up on the
+// host and restarts the service if its unit file is still there.
+// Records of restored files are dropped as they are restored.
+func Restore(host config.Host, cfg *config.Config, h *state.Host, service string) error {
+	if len(h.Backups) == 0 {
+		return nil
+	}
+	if _, err := ssh.SshRetry(host, cfg, stopCommand(service)); err != nil {
+		return err
+	}
+
+	for i := len(h.Backups) - 1; i >= 0; i-- {
+		if _, err := ssh.Ssh(host, cfg, restoreCommand(h.Backups[i])); err != nil {
+			return err
+		}
+		h.Backups = h.Backups[:i]
+	}
+
+	_, err := ssh.SshRetry(host, cfg, restartCommand(service))
+	return err
+}
+
+// Prune deletes backups made on the host once they are not needed
+func Prune(host config.Host, cfg *config.Config, h *state.Host) error {
+	if len(h.Backups) == 0 {
+		return nil
+	}
+	if command := pruneCommand(h.Backups); command != "" {
+		if _, err := ssh.SshRetry(host, cfg, command); err != nil {
+			return err
+		}
+	}
+	h.Backups = nil
+	return nil
+}
+
+func backupCommand(path, backupPath string) string {
+	return fmt.Sprintf("bash -c \"if [ -e %s ]; then cp -a %s %s && echo existed; fi\"", path, path, backupPath)
+}
+
+// restoreCommand puts back the backup, or removes the file created
+// by deploy when there was nothing to back up
+func restoreCommand(backup state.Backup) string {
+	if backup.Existed {
+		return fmt.Sprintf("mv -f %s %s", backup.BackupPath, backup.Path)
+	}
+	return fmt.Sprintf("rm -f %s", backup.Path)
+}
+
+func stopCommand(service string) string {
+	return fmt.Sprintf("bash -c \"systemctl stop %s || true\"", service)
+}
+
+func restartCommand(service string) string {
+	unitFile := fmt.Sprintf("/etc/systemd/system/%s.service", service)
+	return fmt.Sprintf("bash -c \"systemctl daemon-reload; if [ -f %s ]; then systemctl restart %s; fi\"", unitFile, service)
+}
+
+// pruneCommand removes backup copies, it is empty when no file
+// was copied
+func pruneCommand(backups []state.Backup) string {
+	paths := []string{}
+	for _, backup := range backups {
+		if backup.Existed {
+			paths = append(paths, backup.BackupPath)
+		}
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+	return "rm -f " + strings.Join(paths, " ")
+}
@@ -0,0 +1,39 @@
+package rollback
+
+import (
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+func TestCommands(t *testing.T) {
+	existed := state.Backup{Path: "/etc/consul.d/consul.hcl", BackupPath: "/etc/consul.d/consul.hcl.nomad-deploy.bak", Existed: true}
+	binary := state.Backup{Path: "/usr/local/bin/consul", BackupPath: "/usr/local/bin/consul.nomad-deploy.bak", Existed: true}
+	created := state.Backup{Path: "/etc/consul.d/server.hcl"}
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{
+			"backup",
+			backupCommand("/usr/local/bin/consul", "/usr/local/bin/consul.nomad-deploy.bak"),
+			`bash -c "if [ -e /usr/local/bin/consul ]; then cp -a /usr/local/bin/consul /usr/local/bin/consul.nomad-deploy.bak && echo existed; fi"`,
+		},
+		{"restore existed", restoreCommand(existed), "mv -f /etc/consul.d/consul.hcl.nomad-deploy.bak /etc/consul.d/consul.hcl"},
+		{"restore created", restoreCommand(created), "rm -f /etc/consul.d/server.hcl"},
+		{"stop", stopCommand("consul"), `bash -c "systemctl stop consul || true"`},
+		{
+			"restart",
+			restartCommand("nomad"),
+			`bash -c "systemctl daemon-reload; if [ -f /etc/systemd/system/nomad.service ]; then systemctl restart nomad; fi"`,
+		},
+		{"prune", pruneCommand([]state.Backup{existed, created, binary}), "rm -f " + existed.BackupPath + " " + binary.BackupPath},
+		{"prune created only", pruneCommand([]state.Backup{created}), ""},
+	}
+	for _, test := range tests {
+		if test.command != test.expected {
+			t.Errorf("%s: command\n%s\nexpected\n%s", test.name, test.command, test.expected)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package runlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+// Verbose makes stdout of remote commands shown on console too,
+// stderr is always shown
+var Verbose bool
+
+// secretLine matches tokens printed by acl bootstrap
+var secretLine = regexp.MustCompile(`(?i)(secret\s*id\s*[:=]\s*)\S+`)
+
+var (
+	mu      sync.Mutex
+	dir     string
+	step    = "-"
+	files   = make(map[string]*os.File)
+	secrets []string
+)
+
+// Dir returns directory with log files of this run, empty when
+// nothing was logged yet
+func Dir() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return dir
+}
+
+// SetStep sets name of the step remote output is tagged with
+func SetStep(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	step = name
+}
+
+// Redact hides secret in console and log file output
+func Redact(secret string) {
+	if secret == "" {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+// Command records remote command about to be run on the host
+func Command(host, command string) {
+	mu.Lock()
+	defer mu.Unlock()
+	write(host, "command", command)
+}
+
+// Result records how remote command on the host finished
+func Result(host string, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		write(host, "result", err.Error())
+	} else {
+		write(host, "result", "ok")
+	}
+}
+
+// Writer returns writer splitting remote output into lines, which are
+// written into the host log file and shown on console prefixed with
+// host name. Writer must be closed to flush the last incomplete line.
+func Writer(host, stream string, console bool) io.WriteCloser {
+	if console {
+		return &lineWriter{host: host, stream: stream, out: os.Stderr}
+	}
+	return &lineWriter{host: host, stream: stream}
+}
+
+// Tee is like Writer, but prefixed lines are written into out
+func Tee(host, stream string, out io.Writer) io.WriteCloser {
+	return &lineWriter{host: host, stream: stream, out: out}
+}
+
+// Close closes log files of this run
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	for host, file := range files {
+		file.Close()
+		delete(files, host)
+	}
+}
+
+type lineWriter struct {
+	host   string
+	stream string
+	out    io.Writer
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
+
+func (w *lineWriter) line(line string) {
+	mu.Lock()
+	defer mu.Unlock()
+	line = redact(strings.TrimRight(line, "\r"))
+	if w.out != nil {
+		fmt.Fprintf(w.out, "[%s] %s\n", w.host, line)
+	}
+	write(w.host, w.stream, line)
+}
+
+// RedactString hides secrets registered by Redact in s
+func RedactString(s string) string {
+	mu.Lock()
+	defer mu.Unlock()
+	return redact(s)
+}
+
+func redact(line string) string {
+	for _, secret := range secrets {
+		line = strings.ReplaceAll(line, secret, "<redacted>")
+	}
+	return secretLine.ReplaceAllString(line, "${1}<redacted>")
+}
+
+// write appends line to the host log file, mu must be held
+func write(host, stream, line string) {
+	file, err := hostFile(host)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(file, "%s [%s] %s: %s\n", time.Now().Format(time.RFC3339), step, stream, redact(line))
+}
+
+func hostFile(host string) (*os.File, error) {
+	if file, ok := files[host]; ok {
+		return file, nil
+	}
+	if dir == "" {
+		runDir := filepath.Join(state.Dir, "logs", time.Now().Format("20060102-150405"))
+		if err := os.MkdirAll(runDir, 0700); err != nil {
+			return nil, err
+		}
+		dir = runDir
+	}
+	file, err := os.OpenFile(filepath.Join(dir, host+".log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	files[host] = file
+	return file, nil
+}
@@ -0,0 +1,125 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// PassphraseEnv is the environment variable taking passphrase of
+// secrets file in non-interactive runs
+const PassphraseEnv = "NOMAD_DEPLOY_PASSPHRASE"
+
+// scrypt parameters recommended for interactive logins
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// envelope is the on-disk format of secrets file
+type envelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+func encrypt(plain []byte, passphrase string) ([]byte, error) {
+	e := envelope{Version: 1, KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(e, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	e.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	e.Data = aead.Seal(nil, e.Nonce, plain, nil)
+	return json.MarshalIndent(e, "", "  ")
+}
+
+func decrypt(data []byte, passphrase string) ([]byte, error) {
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("not a secrets file: %w", err)
+	}
+	if e.Version != 1 || e.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported secrets file version %d (%s)", e.Version, e.KDF)
+	}
+	aead, err := newAEAD(e, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, e.Nonce, e.Data, nil)
+	if err != nil {
+		return nil, errors.New("wrong passphrase or corrupted secrets file")
+	}
+	return plain, nil
+}
+
+// newAEAD derives AES-256-GCM key from passphrase
+func newAEAD(e envelope, passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), e.Salt, e.N, e.R, e.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// passphrase takes passphrase from environment or asks it from
+// terminal, twice for the new file
+func passphrase(path string, create bool) (string, error) {
+	if p := os.Getenv(PassphraseEnv); p != "" {
+		return p, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("passphrase of %s is required, set %s", path, PassphraseEnv)
+	}
+	prompt := fmt.Sprintf("Passphrase of %s: ", path)
+	if create {
+		prompt = fmt.Sprintf("New passphrase to encrypt %s: ", path)
+	}
+	p, err := readPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", errors.New("passphrase can't be empty")
+	}
+	if create {
+		again, err := readPassword("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != p {
+			return "", errors.New("passphrases don't match")
+		}
+	}
+	return p, nil
+}
+
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(p), err
+}
@@ -0,0 +1,158 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+// Component holds generated secrets of consul or nomad deployment
+type Component struct {
+	GossipKey      string `json:"gossipKey,omitempty"`
+	CACert         string `json:"caCert,omitempty"`
+	CAKey          string `json:"caKey,omitempty"`
+	BootstrapToken string `json:"bootstrapToken,omitempty"`
+}
+
+// Store is the decrypted content of <cluster>.secrets file kept
+// next to the config
+type Store struct {
+	Cluster    string                `json:"cluster"`
+	Components map[string]*Component `json:"components"`
+
+	path       string
+	passphrase string
+	// saved is the content as it was read or last written, so
+	// unchanged secrets are not re-encrypted
+	saved []byte
+}
+
+// Path returns path of secrets file of the cluster
+func Path(cluster string) string {
+	return filepath.Join(filepath.Dir(config.File), fmt.Sprintf("%s.secrets", cluster))
+}
+
+// Open decrypts secrets of the cluster of the state and moves there
+// secrets kept in the state by older versions. Missing secrets file
+// is not an error, passphrase of the new file is asked on Save.
+// Secrets are saved along with every save of the state.
+func Open(st *state.State) (*Store, error) {
+	s := &Store{
+		Cluster:    st.Cluster,
+		Components: make(map[string]*Component),
+		path:       Path(st.Cluster),
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if s.passphrase, err = passphrase(s.path, false); err != nil {
+			return nil, err
+		}
+		plain, err := decrypt(data, s.passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.path, err)
+		}
+		if err := json.Unmarshal(plain, s); err != nil {
+			return nil, fmt.Errorf("secrets file %s is corrupted: %w", s.path, err)
+		}
+		if s.Components == nil {
+			s.Components = make(map[string]*Component)
+		}
+		s.saved, _ = json.Marshal(s)
+	}
+
+	for name, c := range st.Components {
+		if c.GossipKey == "" && c.CACert == "" && c.CAKey == "" && c.BootstrapToken == "" {
+			continue
+		}
+		sc := s.Component(name)
+		moveString(&sc.GossipKey, &c.GossipKey)
+		moveString(&sc.CACert, &c.CACert)
+		moveString(&sc.CAKey, &c.CAKey)
+		moveString(&sc.BootstrapToken, &c.BootstrapToken)
+	}
+	st.BeforeSave(s.Save)
+	return s, nil
+}
+
+// moveString sets dst to src unless dst is already set, and clears src
+func moveString(dst, src *string) {
+	if *dst == "" {
+		*dst = *src
+	}
+	*src = ""
+}
+
+// Component returns secrets of named component, creating them if needed
+func (s *Store) Component(name string) *Component {
+	c, ok := s.Components[name]
+	if !ok {
+		c = &Component{}
+		s.Components[name] = c
+	}
+	return c
+}
+
+// Delete forgets secrets of named component
+func (s *Store) Delete(name string) {
+	delete(s.Components, name)
+}
+
+// Path returns path of the secrets file
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Unlock asks passphrase of the new secrets file now, so secrets
+// generated by the run are not lost if the prompt at Save is aborted
+func (s *Store) Unlock() error {
+	if s.passphrase != "" {
+		return nil
+	}
+	var err error
+	s.passphrase, err = passphrase(s.path, true)
+	return err
+}
+
+// Save encrypts secrets and atomically writes them to disk if
+// they have changed
+func (s *Store) Save() error {
+	for name, c := range s.Components {
+		if *c == (Component{}) {
+			delete(s.Components, name)
+		}
+	}
+	plain, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(plain, s.saved) || s.saved == nil && len(s.Components) == 0 {
+		return nil
+	}
+	if err := s.Unlock(); err != nil {
+		return err
+	}
+	data, err := encrypt(plain, s.passphrase)
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.saved = plain
+	return nil
+}
@@ -0,0 +1,227 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/pipeline"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+// inTempDir runs test in empty working directory with passphrase
+// taken from environment
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(PassphraseEnv, "secret passphrase")
+	t.Cleanup(func() {
+		os.Unsetenv(PassphraseEnv)
+		os.Chdir(wd)
+	})
+}
+
+// readSecrets decrypts secrets file of the cluster as it is on disk
+func readSecrets(t *testing.T, cluster string) *Store {
+	data, err := ioutil.ReadFile(Path(cluster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := decrypt(data, os.Getenv(PassphraseEnv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Store{}
+	if err := json.Unmarshal(plain, s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// readState reads state file of the cluster as it is on disk
+func readState(t *testing.T, cluster string) *state.State {
+	data, err := ioutil.ReadFile(filepath.Join(state.Dir, cluster+".state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &state.State{}
+	if err := json.Unmarshal(data, st); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestSecretsSavedWithState(t *testing.T) {
+	inTempDir(t)
+	st, err := state.Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	sec, err := Open(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interrupted := errors.New("interrupted")
+	checkDisk := func() {
+		onDisk := readState(t, "dc1")
+		if _, done := onDisk.Components["consul"].Steps["gossip"]; !done {
+			t.Errorf("gossip step is not saved as done")
+		}
+		if key := readSecrets(t, "dc1").Components["consul"].GossipKey; key != "generated" {
+			t.Errorf("gossip key on disk is %q, expected generated", key)
+		}
+	}
+	p := pipeline.Pipeline{
+		Cfg:       &config.Config{},
+		State:     st,
+		Component: "consul",
+		Steps: []pipeline.Step{
+			{
+				Name: "gossip",
+				Once: func() error {
+					sec.Component("consul").GossipKey = "generated"
+					return nil
+				},
+			},
+			{
+				Name:  "install",
+				Hosts: func() []config.Host { return []config.Host{{AgentName: "server1"}} },
+				Run: func(host config.Host) error {
+					// the process may be killed here, so whatever
+					// state says is done must already be on disk
+					checkDisk()
+					return interrupted
+				},
+			},
+		},
+	}
+	if err := p.Run(pipeline.Options{}); !errors.Is(err, interrupted) {
+		t.Fatalf("expected interrupted pipeline, got %v", err)
+	}
+	checkDisk()
+}
+
+func TestRoundTrip(t *testing.T) {
+	inTempDir(t)
+	st, err := state.Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	sec, err := Open(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*sec.Component("consul") = Component{GossipKey: "key", CACert: "cert", CAKey: "ca key", BootstrapToken: "token"}
+	sec.Component("nomad")
+	if err := sec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(Path("dc1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("secrets file mode is %s", info.Mode())
+	}
+
+	read, err := Open(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]*Component{
+		"consul": {GossipKey: "key", CACert: "cert", CAKey: "ca key", BootstrapToken: "token"},
+	}
+	if !reflect.DeepEqual(read.Components, expected) {
+		t.Errorf("read secrets %+v, expected %+v", read.Components, expected)
+	}
+}
+
+func TestOpenFailures(t *testing.T) {
+	inTempDir(t)
+	st, err := state.Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	sec, err := Open(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec.Component("consul").GossipKey = "key"
+	if err := sec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(Path("dc1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(PassphraseEnv, "wrong passphrase")
+	if _, err := Open(st); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("open with wrong passphrase: %v", err)
+	}
+	os.Setenv(PassphraseEnv, "secret passphrase")
+
+	var e envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatal(err)
+	}
+	e.Data[0] ^= 1
+	tampered, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(Path("dc1"), tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(st); err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("open of tampered file: %v", err)
+	}
+}
+
+func TestMoveLegacySecrets(t *testing.T) {
+	inTempDir(t)
+	st, err := state.Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	consul := st.Component("consul")
+	consul.GossipKey, consul.CACert, consul.CAKey, consul.BootstrapToken = "old key", "old cert", "old ca key", "old token"
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	sec, err := Open(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Component{GossipKey: "old key", CACert: "old cert", CAKey: "old ca key", BootstrapToken: "old token"}
+	if *sec.Component("consul") != expected {
+		t.Errorf("moved secrets %+v, expected %+v", *sec.Component("consul"), expected)
+	}
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+	onDisk := readState(t, "dc1").Components["consul"]
+	if onDisk.GossipKey != "" || onDisk.CACert != "" || onDisk.CAKey != "" || onDisk.BootstrapToken != "" {
+		t.Errorf("secrets are left in state: %+v", onDisk)
+	}
+	if moved := readSecrets(t, "dc1").Components["consul"]; *moved != expected {
+		t.Errorf("saved secrets %+v, expected %+v", *moved, expected)
+	}
+}
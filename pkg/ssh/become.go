@@ -0,0 +1,155 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// elevated is remote command wrapped to be run as root
+type elevated struct {
+	command string
+	// stdin is fed to the command
+	stdin string
+	// suPassword is typed when su asks for it on remote terminal
+	suPassword string
+}
+
+// become wraps command to be run as root according to host settings
+func become(host config.Host, command string) (elevated, error) {
+	if !host.Become {
+		return elevated{command: command}, nil
+	}
+	switch host.BecomeMethod {
+	case "", "sudo":
+		if !host.BecomePassword {
+			return elevated{command: "sudo -n sh -c " + shellQuote(command)}, nil
+		}
+		password, err := askPassword("sudo:"+host.User, fmt.Sprintf("[sudo] password for %s: ", host.User))
+		if err != nil {
+			return elevated{}, err
+		}
+		// -k makes sudo read the password even if it is cached, so
+		// the password is never taken for input of the command
+		return elevated{command: "sudo -k -S -p '' sh -c " + shellQuote(command), stdin: password + "\n"}, nil
+	case "doas":
+		if host.BecomePassword {
+			return elevated{}, fmt.Errorf("%s: becomePassword is not supported with doas", host.Address)
+		}
+		return elevated{command: "doas -n sh -c " + shellQuote(command)}, nil
+	case "su":
+		if !host.BecomePassword {
+			return elevated{}, fmt.Errorf("%s: su requires root password, set becomePassword", host.Address)
+		}
+		password, err := askPassword("su:root", "[su] password for root: ")
+		if err != nil {
+			return elevated{}, err
+		}
+		// terminal echo is turned off, so input of the command is
+		// not mixed into its output
+		command = "stty -echo 2>/dev/null; " + command
+		return elevated{command: "su root -c " + shellQuote(command), suPassword: password}, nil
+	default:
+		return elevated{}, fmt.Errorf("%s: unknown become method %q", host.Address, host.BecomeMethod)
+	}
+}
+
+// remoteCommand builds ssh invocation running elevated command with its
+// output written to stdout and stderr. Returned func releases resources
+// of the invocation once it is done.
+func remoteCommand(ctx context.Context, host config.Host, cfg *config.Config, e elevated, stdout, stderr io.Writer) (*exec.Cmd, func(), error) {
+	if e.suPassword == "" {
+		cmd, err := newCommand(ctx, "ssh", host, cfg, target(host), e.command)
+		if err != nil {
+			return nil, nil, err
+		}
+		if e.stdin != "" {
+			cmd.Stdin = strings.NewReader(e.stdin)
+		}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return cmd, func() {}, nil
+	}
+
+	// su reads password from terminal only and discards input typed
+	// before it asks, so the password is typed once prompt is seen
+	cmd, err := newCommand(ctx, "ssh", host, cfg, "-tt", target(host), e.command)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.Stdin = r
+	cmd.Stdout = &suTerminal{out: stdout, input: w, typed: e.suPassword + "\n" + e.stdin}
+	cmd.Stderr = stderr
+	return cmd, func() {
+		r.Close()
+		w.Close()
+	}, nil
+}
+
+// suTerminal is output of su on remote terminal. It types password and
+// input of the command once su prompts for password, and hides the
+// prompt and carriage returns added by terminal from the output.
+type suTerminal struct {
+	out      io.Writer
+	input    io.Writer
+	typed    string
+	prompted bool
+	// pending is output before prompt is complete
+	pending []byte
+	// promptEnd is set until the line of prompt is ended
+	promptEnd bool
+}
+
+func (t *suTerminal) Write(p []byte) (int, error) {
+	n := len(p)
+	if !t.prompted {
+		t.pending = append(t.pending, p...)
+		i := bytes.IndexByte(t.pending, ':')
+		if i < 0 {
+			return n, nil
+		}
+		if _, err := io.WriteString(t.input, t.typed); err != nil {
+			return 0, err
+		}
+		p = t.pending[i+1:]
+		t.prompted, t.promptEnd, t.pending = true, true, nil
+	}
+	p = bytes.ReplaceAll(p, []byte("\r"), nil)
+	if t.promptEnd {
+		p = bytes.TrimLeft(p, " ")
+		if len(p) > 0 {
+			p = bytes.TrimPrefix(p, []byte("\n"))
+			t.promptEnd = false
+		}
+	}
+	if _, err := t.out.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// tempPath returns unique path in remote /tmp for the file, where it is
+// uploaded before being installed into its destination
+func tempPath(localPath string) string {
+	return fmt.Sprintf("/tmp/nomad-deploy-%d-%s", time.Now().UnixNano(), filepath.Base(localPath))
+}
+
+// exportCommand copies root owned file where ssh user can read it
+func exportCommand(host config.Host, remotePath, tmpPath string) string {
+	return strings.Join([]string{
+		fmt.Sprintf("cp %s %s", remotePath, tmpPath),
+		fmt.Sprintf("chown %s %s", host.User, tmpPath),
+	}, " && ")
+}
@@ -0,0 +1,36 @@
+package ssh
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSuTerminal(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		typed  string
+		output string
+	}{
+		{"no prompt yet", []string{"Pass"}, "", ""},
+		{"prompt and output at once", []string{"Password: \r\nok\r\n"}, "secret\ninput", "ok\n"},
+		{"prompt split", []string{"Pass", "word:", " ", "\r\n", "line1\r\nline2\r\n"}, "secret\ninput", "line1\nline2\n"},
+		{"failure", []string{"Password: ", "\r\nsu: Authentication failure\r\n"}, "secret\ninput", "su: Authentication failure\n"},
+		{"empty output", []string{"Password: \r\n"}, "secret\ninput", ""},
+	}
+	for _, test := range tests {
+		out, input := bytes.Buffer{}, bytes.Buffer{}
+		terminal := &suTerminal{out: &out, input: &input, typed: "secret\ninput"}
+		for _, chunk := range test.chunks {
+			if n, err := terminal.Write([]byte(chunk)); err != nil || n != len(chunk) {
+				t.Fatalf("%s: write returned %d, %v", test.name, n, err)
+			}
+		}
+		if input.String() != test.typed {
+			t.Errorf("%s: typed %q, expected %q", test.name, input.String(), test.typed)
+		}
+		if out.String() != test.output {
+			t.Errorf("%s: output %q, expected %q", test.name, out.String(), test.output)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/state"
+)
+
+// KnownHostsFile is project-local known_hosts file, host keys of
+// all cluster and jump hosts are verified against it
+var KnownHostsFile = filepath.Join(state.Dir, "known_hosts")
+
+// verifyOptions makes ssh fail on unknown or changed host keys
+func verifyOptions() []string {
+	knownHosts, err := filepath.Abs(KnownHostsFile)
+	if err != nil {
+		knownHosts = KnownHostsFile
+	}
+	return []string{
+		"-o", "UserKnownHostsFile=" + knownHosts,
+		"-o", "StrictHostKeyChecking=yes",
+	}
+}
+
+// Endpoint is ssh server along with jump hosts it is reached through
+type Endpoint struct {
+	Address string
+	Port    int64
+	Jumps   []config.JumpHost
+}
+
+func (e Endpoint) String() string {
+	return fmt.Sprintf("%s:%d", e.Address, e.Port)
+}
+
+// Endpoints returns all jump and cluster hosts in order they must be
+// trusted, so every jump host is known before hosts behind it
+func Endpoints(cfg *config.Config) []Endpoint {
+	endpoints := []Endpoint{}
+	seen := make(map[string]bool)
+	add := func(e Endpoint) {
+		if !seen[e.String()] {
+			seen[e.String()] = true
+			endpoints = append(endpoints, e)
+		}
+	}
+	for _, host := range cfg.AllHosts() {
+		jumps := cfg.Jumps(host)
+		for i, jump := range jumps {
+			add(Endpoint{Address: jump.Address, Port: jumpPort(jump), Jumps: jumps[:i]})
+		}
+		add(Endpoint{Address: host.Address, Port: host.SshPort, Jumps: jumps})
+	}
+	return endpoints
+}
+
+// HostKey is a single known_hosts entry
+type HostKey struct {
+	Host string
+	Type string
+	Key  string
+}
+
+// Fingerprint returns SHA256 fingerprint as shown by OpenSSH
+func (k HostKey) Fingerprint() string {
+	raw, err := base64.StdEncoding.DecodeString(k.Key)
+	if err != nil {
+		return "invalid key"
+	}
+	sum := sha256.Sum256(raw)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+func (k HostKey) String() string {
+	return fmt.Sprintf("%s %s %s", k.Host, k.Type, k.Key)
+}
+
+// Keyscan fetches host keys of the endpoint. Endpoints behind jump
+// hosts are scanned from the last jump host.
+func Keyscan(cfg *config.Config, e Endpoint) ([]HostKey, error) {
+	cmd := exec.Command("ssh-keyscan", "-p", strconv.Itoa(int(e.Port)), e.Address)
+	if len(e.Jumps) > 0 {
+		opts, destination := jumpOptions(cfg, e.Jumps)
+		cmd = exec.Command("ssh", append(opts, destination, strings.Join(cmd.Args, " "))...)
+	}
+	output := bytes.Buffer{}
+	cmd.Stdout = &output
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	keys := parseHostKeys(output.String())
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no host keys received from %s", e)
+	}
+	return keys, nil
+}
+
+// KnownHostKeys reads project-local known_hosts file
+func KnownHostKeys() ([]HostKey, error) {
+	file, err := os.ReadFile(KnownHostsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseHostKeys(string(file)), nil
+}
+
+// CheckHostKey returns true when the key is already known and error
+// when another key of the same type is known for the host
+func CheckHostKey(known []HostKey, key HostKey) (bool, error) {
+	for _, k := range known {
+		if k.Host != key.Host || k.Type != key.Type {
+			continue
+		}
+		if k.Key != key.Key {
+			return false, fmt.Errorf("HOST KEY MISMATCH for %s: known %s %s, got %s",
+				key.Host, k.Type, k.Fingerprint(), key.Fingerprint())
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Trust appends keys to project-local known_hosts file
+func Trust(keys []HostKey) error {
+	if err := os.MkdirAll(filepath.Dir(KnownHostsFile), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(KnownHostsFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for _, key := range keys {
+		if _, err := fmt.Fprintln(file, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseHostKeys(content string) []HostKey {
+	keys := []HostKey{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		keys = append(keys, HostKey{Host: fields[0], Type: fields[1], Key: fields[2]})
+	}
+	return keys
+}
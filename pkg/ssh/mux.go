@@ -0,0 +1,103 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// connectionLost is exit code of ssh when connection failed, as
+// opposed to exit code of remote command
+const connectionLost = 255
+
+var (
+	muxMu sync.Mutex
+	// muxDir keeps control sockets of master connections of this run
+	muxDir string
+	// masters are master connections opened by target
+	masters = make(map[string]master)
+)
+
+// master is the host with master connection opened and config it was
+// opened with, which is needed to find its control socket
+type master struct {
+	host config.Host
+	cfg  *config.Config
+}
+
+// muxOptions make all ssh and scp invocations to the host reuse single
+// master connection, which lives until Close is called
+func muxOptions(host config.Host, cfg *config.Config) []string {
+	muxMu.Lock()
+	defer muxMu.Unlock()
+	if muxDir == "" {
+		dir, err := ioutil.TempDir("", "nomad-deploy-ssh")
+		if err != nil {
+			// multiplexing is optimization, run without it
+			return keepaliveOptions()
+		}
+		muxDir = dir
+	}
+	masters[fmt.Sprintf("%s:%d", target(host), host.SshPort)] = master{host: host, cfg: cfg}
+
+	return append(keepaliveOptions(),
+		"-o", "ControlMaster=auto",
+		"-o", "ControlPath="+muxDir+"/%C",
+		"-o", "ControlPersist=10m",
+	)
+}
+
+func keepaliveOptions() []string {
+	return []string{
+		"-o", "ServerAliveInterval=15",
+		"-o", "ServerAliveCountMax=3",
+	}
+}
+
+// isConnectionLost reports whether ssh failed to talk to remote host
+func isConnectionLost(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == connectionLost
+}
+
+// dropMaster closes master connection to the host, so next command
+// establishes a fresh one
+func dropMaster(host config.Host, cfg *config.Config) {
+	muxMu.Lock()
+	dir := muxDir
+	muxMu.Unlock()
+	closeMaster(master{host: host, cfg: cfg}, dir)
+}
+
+// closeMaster asks master connection to exit. Control socket path
+// is a hash of connection parameters, which ssh_config may change, so
+// the options must be the same as of the connection.
+func closeMaster(m master, dir string) {
+	if dir == "" {
+		return
+	}
+	args := append(commonOptions(m.cfg),
+		"-o", "ControlPath="+dir+"/%C",
+		"-o", fmt.Sprintf("Port=%d", m.host.SshPort),
+		"-O", "exit", target(m.host))
+	exec.Command("ssh", args...).Run()
+}
+
+// Close terminates all master connections opened during the run
+func Close() {
+	muxMu.Lock()
+	defer muxMu.Unlock()
+	for _, m := range masters {
+		closeMaster(m, muxDir)
+	}
+	if muxDir != "" {
+		os.RemoveAll(muxDir)
+	}
+	masters = make(map[string]master)
+	muxDir = ""
+}
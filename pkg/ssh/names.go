@@ -0,0 +1,43 @@
+package ssh
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// ResolveNames sets agent names of hosts without one, or of all hosts,
+// to their remote hostnames and tells whether any name was changed.
+// Resulting names must be unique.
+func ResolveNames(cfg *config.Config, all bool) (bool, error) {
+	changed := false
+	for _, hosts := range [][]config.Host{cfg.Servers, cfg.Clients} {
+		for i := range hosts {
+			if hosts[i].AgentName != "" && !all {
+				continue
+			}
+			output, err := SshRetry(hosts[i], cfg, "hostname -s")
+			if err != nil {
+				return false, fmt.Errorf("failed to get hostname of %s: %w", hosts[i].Address, err)
+			}
+			name := strings.TrimSpace(output)
+			if name != hosts[i].AgentName {
+				log.Printf("Agent name of %s is %s\n", hosts[i].Address, name)
+				hosts[i].AgentName = name
+				changed = true
+			}
+		}
+	}
+
+	seen := map[string]string{}
+	for _, host := range cfg.AllHosts() {
+		if address, ok := seen[host.AgentName]; ok {
+			return false, fmt.Errorf("hosts %s and %s are both named %s, set agentName of one of them explicitly",
+				address, host.Address, host.AgentName)
+		}
+		seen[host.AgentName] = host.Address
+	}
+	return changed, nil
+}
@@ -0,0 +1,68 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"golang.org/x/term"
+)
+
+// passwordEnv passes ssh password to this very binary run by ssh
+// as SSH_ASKPASS helper
+const passwordEnv = "NOMAD_DEPLOY_SSH_PASSWORD"
+
+var (
+	passwordsMu sync.Mutex
+	// passwords asked during this run, they are never stored
+	passwords = make(map[string]string)
+)
+
+// askPassword asks password from terminal once per key
+func askPassword(key, prompt string) (string, error) {
+	passwordsMu.Lock()
+	defer passwordsMu.Unlock()
+	if password, ok := passwords[key]; ok {
+		return password, nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	passwords[key] = string(password)
+	return string(password), nil
+}
+
+// askpassEnv returns environment making ssh take password of the
+// host from this binary instead of terminal
+func askpassEnv(host config.Host) ([]string, error) {
+	password, err := askPassword("ssh:"+target(host), fmt.Sprintf("%s's password: ", target(host)))
+	if err != nil {
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		passwordEnv + "=" + password,
+		"SSH_ASKPASS=" + self,
+		"SSH_ASKPASS_REQUIRE=force",
+		"DISPLAY=none",
+	}, nil
+}
+
+// Askpass prints ssh password and returns true when the binary is
+// run by ssh as SSH_ASKPASS helper
+func Askpass() bool {
+	password, ok := os.LookupEnv(passwordEnv)
+	if !ok {
+		return false
+	}
+	fmt.Println(password)
+	return true
+}
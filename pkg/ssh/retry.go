@@ -0,0 +1,99 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+var errTimeout = errors.New("timed out")
+
+var (
+	// baseCtx is cancelled on interrupt, killing all remote operations
+	baseCtx = context.Background()
+
+	retriesMu sync.Mutex
+	// retries counts retried operations by host
+	retries = make(map[string]int)
+)
+
+// SetContext sets context whose cancellation aborts all remote operations
+func SetContext(ctx context.Context) {
+	baseCtx = ctx
+}
+
+// run runs command built by newCmd within timeout. Idempotent
+// operations are retried on timeouts and connection loss, up to
+// configured number of attempts with exponential backoff. Others are
+// never retried: connection may have dropped after the command ran,
+// and exit code 255 may come from the command itself.
+func run(host config.Host, cfg *config.Config, timeout time.Duration, idempotent bool,
+	newCmd func(ctx context.Context) (*exec.Cmd, error)) error {
+	attempts := 1
+	if idempotent {
+		attempts = cfg.RetryAttempts()
+	}
+	delay := cfg.RetryBackoff()
+
+	for attempt := 1; ; attempt++ {
+		err := runOnce(timeout, newCmd)
+		if err == nil || baseCtx.Err() != nil {
+			return err
+		}
+		lost := isConnectionLost(err)
+		if lost {
+			dropMaster(host, cfg)
+		}
+		if !(lost || errors.Is(err, errTimeout)) || attempt >= attempts {
+			return err
+		}
+
+		wait := delay
+		delay *= 2
+		retriesMu.Lock()
+		retries[host.AgentName]++
+		retriesMu.Unlock()
+		log.Printf("[%s] attempt %d/%d failed: %s, retrying in %s\n", host.AgentName, attempt, attempts, err, wait)
+
+		select {
+		case <-time.After(wait):
+		case <-baseCtx.Done():
+			return baseCtx.Err()
+		}
+	}
+}
+
+func runOnce(timeout time.Duration, newCmd func(ctx context.Context) (*exec.Cmd, error)) error {
+	ctx, cancel := context.WithTimeout(baseCtx, timeout)
+	defer cancel()
+	cmd, err := newCmd(ctx)
+	if err != nil {
+		return err
+	}
+	err = cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s %w after %s", cmd.Args[0], errTimeout, timeout)
+	}
+	return err
+}
+
+// RetryReport returns summary of retried operations per host, empty
+// when nothing was retried
+func RetryReport() string {
+	retriesMu.Lock()
+	defer retriesMu.Unlock()
+	report := []string{}
+	for name, count := range retries {
+		report = append(report, fmt.Sprintf("%s: %d", name, count))
+	}
+	sort.Strings(report)
+	return strings.Join(report, ", ")
+}
@@ -2,40 +2,299 @@ package ssh
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"strconv"
+	"strings"
+	"time"
 
 	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/runlog"
 )
 
+// Options tune execution of remote command
+type Options struct {
+	// Input is fed to stdin of the command and never logged, so
+	// secrets are passed there rather than on command line
+	Input string
+	// Timeout replaces command timeout of config
+	Timeout time.Duration
+	// Idempotent commands are retried on transient failures
+	Idempotent bool
+}
+
 // Ssh simply executes any shell command on remote host
 func Ssh(host config.Host, cfg *config.Config, command string) (string, error) {
-	cmd := exec.Command("ssh",
-		"-p", strconv.Itoa(int(host.SshPort)),
-		"-i", cfg.SSHKey,
-		fmt.Sprintf("%s@%s", host.User, host.Address),
-		command)
-	cmd.Stderr = os.Stderr
+	return SshWith(host, cfg, command, Options{})
+}
 
-	output := bytes.Buffer{}
-	cmd.Stdout = &output
+// SshRetry executes idempotent command on remote host, retrying it
+// on transient failures
+func SshRetry(host config.Host, cfg *config.Config, command string) (string, error) {
+	return SshWith(host, cfg, command, Options{Idempotent: true})
+}
 
-	if err := cmd.Run(); err != nil {
+// SshWith executes shell command on remote host with options
+func SshWith(host config.Host, cfg *config.Config, command string, opts Options) (string, error) {
+	runlog.Command(logName(host), command)
+	e, err := become(host, command)
+	if err != nil {
+		return "", err
+	}
+	e.stdin += opts.Input
+	timeout := cfg.CommandTimeout()
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+
+	output := bytes.Buffer{}
+	stdout := runlog.Writer(logName(host), "stdout", runlog.Verbose)
+	stderr := runlog.Writer(logName(host), "stderr", true)
+	release := func() {}
+	err = run(host, cfg, timeout, opts.Idempotent, func(ctx context.Context) (*exec.Cmd, error) {
+		release()
+		output.Reset()
+		cmd, r, err := remoteCommand(ctx, host, cfg, e, io.MultiWriter(&output, stdout), stderr)
+		if err != nil {
+			return nil, err
+		}
+		release = r
+		return cmd, nil
+	})
+	release()
+	stdout.Close()
+	stderr.Close()
+	runlog.Result(logName(host), err)
+	if err != nil {
 		return "", err
 	}
 	return output.String(), nil
 }
 
-// Scp simply copies local file to remote host
-func Scp(host config.Host, cfg *config.Config, localPath, remotePath string) error {
-	cmd := exec.Command("scp",
-		"-P", strconv.Itoa(int(host.SshPort)),
-		"-i", cfg.SSHKey,
-		localPath,
-		fmt.Sprintf("%s@%s:%s", host.User, host.Address, remotePath))
-	cmd.Stderr = os.Stderr
+// Download simply copies remote file to local path
+func Download(host config.Host, cfg *config.Config, remotePath, localPath string) error {
+	if !host.Become {
+		return scp(host, cfg, remoteFile(host, remotePath), localPath)
+	}
+	tmpPath := tempPath(remotePath)
+	if _, err := Ssh(host, cfg, exportCommand(host, remotePath, tmpPath)); err != nil {
+		return err
+	}
+	defer Ssh(host, cfg, fmt.Sprintf("rm -f %s", tmpPath))
+	return scp(host, cfg, remoteFile(host, tmpPath), localPath)
+}
+
+func scp(host config.Host, cfg *config.Config, from, to string) error {
+	runlog.Command(logName(host), fmt.Sprintf("scp %s %s", from, to))
+	stderr := runlog.Writer(logName(host), "stderr", true)
+	err := run(host, cfg, cfg.UploadTimeout(), true, func(ctx context.Context) (*exec.Cmd, error) {
+		cmd, err := newCommand(ctx, "scp", host, cfg, from, to)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stderr = stderr
+		return cmd, nil
+	})
+	stderr.Close()
+	runlog.Result(logName(host), err)
+	return err
+}
+
+// newCommand builds ssh or scp invocation connecting to the host
+func newCommand(ctx context.Context, name string, host config.Host, cfg *config.Config, args ...string) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, name, append(options(host, cfg), args...)...)
+	if cfg.UsePasswordAuth(host) {
+		env, err := askpassEnv(host)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd, nil
+}
+
+// logName identifies the host in logs
+func logName(host config.Host) string {
+	if host.AgentName != "" {
+		return host.AgentName
+	}
+	return host.Address
+}
+
+func target(host config.Host) string {
+	return fmt.Sprintf("%s@%s", host.User, host.Address)
+}
+
+// remoteFile returns scp argument of the file on remote host, IPv6
+// addresses are bracketed so their colons are not taken for path
+func remoteFile(host config.Host, path string) string {
+	if strings.Contains(host.Address, ":") {
+		return fmt.Sprintf("%s@[%s]:%s", host.User, host.Address, path)
+	}
+	return fmt.Sprintf("%s:%s", target(host), path)
+}
+
+// options returns command line options understood both by ssh and scp
+func options(host config.Host, cfg *config.Config) []string {
+	opts := append(commonOptions(cfg), "-o", fmt.Sprintf("Port=%d", host.SshPort))
+	switch {
+	case cfg.UsePasswordAuth(host):
+		opts = append(opts,
+			"-o", "PreferredAuthentications=password,keyboard-interactive",
+			"-o", "PubkeyAuthentication=no")
+	case cfg.UseSSHAgent(host):
+		// keys are offered by ssh-agent
+	case cfg.SSHKeyPath(host) != "":
+		opts = append(opts, "-i", cfg.SSHKeyPath(host))
+	}
+	opts = append(opts, muxOptions(host, cfg)...)
+	if jumps := cfg.Jumps(host); len(jumps) > 0 {
+		opts = append(opts, "-o", "ProxyCommand="+proxyCommand(cfg, jumps, host.Address, host.SshPort))
+	}
+	return opts
+}
+
+// jumpOptions returns ssh options and destination connecting to the
+// last jump host, which itself is reached through the rest of chain
+func jumpOptions(cfg *config.Config, jumps []config.JumpHost) ([]string, string) {
+	jump := jumps[len(jumps)-1]
+	destination := jump.Address
+	if jump.User != "" {
+		destination = fmt.Sprintf("%s@%s", jump.User, jump.Address)
+	}
 
+	opts := append(commonOptions(cfg), "-o", fmt.Sprintf("Port=%d", jumpPort(jump)))
+	if jump.SSHKey != "" {
+		opts = append(opts, "-i", config.ExpandPath(jump.SSHKey))
+	} else if !cfg.SSHAgent && cfg.SSHKey != "" {
+		opts = append(opts, "-i", config.ExpandPath(cfg.SSHKey))
+	}
+	if len(jumps) > 1 {
+		opts = append(opts, "-o", "ProxyCommand="+proxyCommand(cfg, jumps[:len(jumps)-1], jump.Address, jumpPort(jump)))
+	}
+	return opts, destination
+}
+
+// proxyCommand builds ssh command forwarding connection to address
+// through the chain of jump hosts
+func proxyCommand(cfg *config.Config, jumps []config.JumpHost, address string, port int64) string {
+	opts, destination := jumpOptions(cfg, jumps)
+	// destination is explicit rather than %h:%p, because nested
+	// proxy commands are expanded by the outermost ssh
+	args := append([]string{"ssh"}, opts...)
+	args = append(args, "-W", fmt.Sprintf("[%s]:%d", address, port), destination)
+
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// commonOptions returns options used for every connection
+func commonOptions(cfg *config.Config) []string {
+	opts := append(verifyOptions(),
+		"-o", fmt.Sprintf("ConnectTimeout=%d", int(cfg.ConnectTimeout().Seconds())))
+	if cfg.SSHConfig != "" {
+		opts = append(opts, "-F", config.ExpandPath(cfg.SSHConfig))
+	}
+	return opts
+}
+
+func jumpPort(jump config.JumpHost) int64 {
+	if jump.SshPort == 0 {
+		return 22
+	}
+	return jump.SshPort
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Output executes shell command on remote host and returns its combined
+// stdout and stderr with exit code. Non-zero exit code of the command is
+// not an error, failure to connect is.
+func Output(host config.Host, cfg *config.Config, command string) (string, int, error) {
+	return OutputWith(host, cfg, command, Options{})
+}
+
+// OutputWith is Output with options, command is never retried
+func OutputWith(host config.Host, cfg *config.Config, command string, opts Options) (string, int, error) {
+	runlog.Command(logName(host), command)
+	e, err := become(host, command)
+	if err != nil {
+		return "", 0, err
+	}
+	e.stdin += opts.Input
+	timeout := cfg.CommandTimeout()
+	if opts.Timeout > 0 {
+		timeout = opts.Timeout
+	}
+
+	output := bytes.Buffer{}
+	stdout := runlog.Writer(logName(host), "stdout", false)
+	stderr := runlog.Writer(logName(host), "stderr", false)
+	release := func() {}
+	err = run(host, cfg, timeout, false, func(ctx context.Context) (*exec.Cmd, error) {
+		release()
+		output.Reset()
+		cmd, r, err := remoteCommand(ctx, host, cfg, e, io.MultiWriter(&output, stdout), io.MultiWriter(&output, stderr))
+		if err != nil {
+			return nil, err
+		}
+		release = r
+		return cmd, nil
+	})
+	release()
+	stdout.Close()
+	stderr.Close()
+	runlog.Result(logName(host), err)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && !isConnectionLost(err) {
+		return output.String(), exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return output.String(), 0, err
+	}
+	return output.String(), 0, nil
+}
+
+// Interactive opens interactive shell session on remote host using
+// the terminal of this process
+func Interactive(host config.Host, cfg *config.Config) error {
+	cmd, err := newCommand(baseCtx, "ssh", host, cfg, "-t", target(host))
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// Stream executes long running shell command on remote host, like
+// following logs, writing its output to w as it comes. Command has
+// no timeout and is stopped only by interrupt.
+func Stream(host config.Host, cfg *config.Config, command string, w io.Writer) error {
+	runlog.Command(logName(host), command)
+	e, err := become(host, command)
+	if err != nil {
+		return err
+	}
+	cmd, release, err := remoteCommand(baseCtx, host, cfg, e, w, w)
+	if err != nil {
+		return err
+	}
+	err = cmd.Run()
+	release()
+	if baseCtx.Err() != nil {
+		err = baseCtx.Err()
+	}
+	runlog.Result(logName(host), err)
+	return err
+}
@@ -0,0 +1,67 @@
+package ssh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// Modes of uploaded files
+const (
+	ModeBinary os.FileMode = 0755
+	ModeConfig os.FileMode = 0644
+	ModeSecret os.FileMode = 0600
+)
+
+// Scp copies local file to remote host atomically. File is uploaded
+// into /tmp, verified by sha256 and installed next to its destination
+// with the mode, then renamed over it, so an interrupted upload never
+// leaves truncated file behind. Installed files are owned by root,
+// when the host is deployed as root.
+func Scp(host config.Host, cfg *config.Config, localPath, remotePath string, mode os.FileMode) error {
+	sum, err := sha256File(localPath)
+	if err != nil {
+		return err
+	}
+	tmpPath := tempPath(localPath)
+	if err := scp(host, cfg, localPath, remoteFile(host, tmpPath)); err != nil {
+		return err
+	}
+	_, err = Ssh(host, cfg, installCommand(host, tmpPath, remotePath, sum, mode))
+	return err
+}
+
+// installCommand verifies checksum of uploaded file and moves it into
+// its destination
+func installCommand(host config.Host, tmpPath, remotePath, sum string, mode os.FileMode) string {
+	owner := ""
+	if host.Become || host.User == "root" {
+		owner = "-o root -g root "
+	}
+	partPath := remotePath + ".nomad-deploy.part"
+	return strings.Join([]string{
+		fmt.Sprintf(`if [ "$(sha256sum %s | cut -d ' ' -f 1)" != %s ]; then rm -f %s; echo "checksum mismatch of uploaded %s" >&2; exit 1; fi`,
+			tmpPath, sum, tmpPath, remotePath),
+		fmt.Sprintf("install -m %04o %s%s %s", mode, owner, tmpPath, partPath),
+		fmt.Sprintf("mv -f %s %s", partPath, remotePath),
+		fmt.Sprintf("rm -f %s", tmpPath),
+	}, " && ")
+}
+
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,287 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.gs-labs.tv/casdevops/nomad-deploy/pkg/config"
+)
+
+// Dir is the local directory where cluster state files are kept
+const Dir = ".nomad-deploy"
+
+// Host holds facts about a single deployed agent
+type Host struct {
+	Address       string               `json:"address"`
+	Role          string               `json:"role"`
+	BinaryVersion string               `json:"binaryVersion,omitempty"`
+	Steps         map[string]time.Time `json:"steps,omitempty"`
+	Backups       []Backup             `json:"backups,omitempty"`
+	UpdatedAt     time.Time            `json:"updatedAt"`
+}
+
+// Backup describes remote file overwritten by the last deploy
+type Backup struct {
+	Path       string `json:"path"`
+	BackupPath string `json:"backupPath,omitempty"`
+	// Existed is false when file was created by deploy, so
+	// there is nothing to restore and file is just removed
+	Existed bool `json:"existed"`
+}
+
+// Component holds facts of consul or nomad deployment
+type Component struct {
+	BinaryVersion string `json:"binaryVersion,omitempty"`
+	// Secrets generated by older versions, they are only read to
+	// be moved into encrypted secrets file
+	GossipKey      string               `json:"gossipKey,omitempty"`
+	CACert         string               `json:"caCert,omitempty"`
+	CAKey          string               `json:"caKey,omitempty"`
+	BootstrapToken string               `json:"bootstrapToken,omitempty"`
+	Steps          map[string]time.Time `json:"steps,omitempty"`
+	Hosts          map[string]*Host     `json:"hosts,omitempty"`
+	UpdatedAt      time.Time            `json:"updatedAt"`
+}
+
+// State is the content of .nomad-deploy/<cluster>.state.json
+type State struct {
+	Cluster    string                `json:"cluster"`
+	Components map[string]*Component `json:"components"`
+
+	path     string
+	lockPath string
+	// beforeSave are called by Save before state is written
+	beforeSave []func() error
+	// saving serializes Save of deploy and Abort
+	saving sync.Mutex
+}
+
+// locked are states opened by this process, released by Abort
+var (
+	lockedMu sync.Mutex
+	locked   = map[*State]bool{}
+)
+
+// Open locks and reads state of the cluster. Missing state file
+// is not an error, empty state is returned instead. State must be
+// closed to release the lock.
+func Open(cluster string) (*State, error) {
+	if err := os.MkdirAll(Dir, 0700); err != nil {
+		return nil, err
+	}
+	s := newState(cluster)
+	s.lockPath = filepath.Join(Dir, fmt.Sprintf("%s.lock", cluster))
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	lockedMu.Lock()
+	locked[s] = true
+	lockedMu.Unlock()
+
+	if err := s.read(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Read reads state of the cluster without locking it, for commands
+// only showing it. Such state can't be saved.
+func Read(cluster string) (*State, error) {
+	s := newState(cluster)
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newState(cluster string) *State {
+	return &State{
+		Cluster:    cluster,
+		Components: make(map[string]*Component),
+		path:       filepath.Join(Dir, fmt.Sprintf("%s.state.json", cluster)),
+	}
+}
+
+// read loads state file, if it exists
+func (s *State) read() error {
+	file, err := ioutil.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(file, s); err != nil {
+		return fmt.Errorf("state file %s is corrupted: %w", s.path, err)
+	}
+	if s.Components == nil {
+		s.Components = make(map[string]*Component)
+	}
+	return nil
+}
+
+func (s *State) lock() error {
+	lockFile, err := os.OpenFile(s.lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, fs.ErrExist) {
+		owner, _ := ioutil.ReadFile(s.lockPath)
+		return fmt.Errorf("cluster %s is locked by another run (%s) with lock file %s, "+
+			"if that run is dead remove the lock file: rm %s", s.Cluster, owner, s.lockPath, s.lockPath)
+	}
+	if err != nil {
+		return err
+	}
+	defer lockFile.Close()
+
+	hostname, _ := os.Hostname()
+	_, err = fmt.Fprintf(lockFile, "pid %d on %s since %s", os.Getpid(), hostname, time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (s *State) unlock() error {
+	return os.Remove(s.lockPath)
+}
+
+// BeforeSave registers fn to be called on every Save before state is
+// written, so data kept aside, like secrets, is never behind the state
+func (s *State) BeforeSave(fn func() error) {
+	s.beforeSave = append(s.beforeSave, fn)
+}
+
+// Save atomically writes state to disk
+func (s *State) Save() error {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+	if s.lockPath == "" {
+		return fmt.Errorf("state of cluster %s is read without lock and can't be saved", s.Cluster)
+	}
+	for _, fn := range s.beforeSave {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	stateBytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, stateBytes, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Close releases the cluster lock
+func (s *State) Close() error {
+	lockedMu.Lock()
+	defer lockedMu.Unlock()
+	if !locked[s] {
+		return nil
+	}
+	delete(locked, s)
+	return s.unlock()
+}
+
+// Abort saves and releases all states opened by this process, when it
+// has to exit before deferred Save and Close are done
+func Abort() {
+	lockedMu.Lock()
+	states := []*State{}
+	for s := range locked {
+		states = append(states, s)
+	}
+	lockedMu.Unlock()
+
+	for _, s := range states {
+		if err := s.Save(); err != nil {
+			log.Printf("Saving state of cluster %s failed: %s\n", s.Cluster, err)
+		}
+		s.Close()
+	}
+}
+
+// Component returns state of named component, creating it if needed
+func (s *State) Component(name string) *Component {
+	c, ok := s.Components[name]
+	if !ok {
+		c = &Component{}
+		s.Components[name] = c
+	}
+	if c.Hosts == nil {
+		c.Hosts = make(map[string]*Host)
+	}
+	if c.Steps == nil {
+		c.Steps = make(map[string]time.Time)
+	}
+	return c
+}
+
+// Delete forgets everything about named component
+func (s *State) Delete(name string) {
+	delete(s.Components, name)
+}
+
+// Host returns state of the host, creating it if needed
+func (c *Component) Host(cfg *config.Config, host config.Host) *Host {
+	h, ok := c.Hosts[host.AgentName]
+	if !ok {
+		h = &Host{Steps: make(map[string]time.Time)}
+		c.Hosts[host.AgentName] = h
+	}
+	h.Address = host.Address
+	h.Role = cfg.Role(host)
+	return h
+}
+
+// MarkStep records successful completion of cluster-wide step
+func (c *Component) MarkStep(step string) {
+	c.Steps[step] = time.Now()
+	c.UpdatedAt = time.Now()
+}
+
+// MarkStep records successful completion of step on the host
+func (h *Host) MarkStep(step string) {
+	if h.Steps == nil {
+		h.Steps = make(map[string]time.Time)
+	}
+	h.Steps[step] = time.Now()
+	h.UpdatedAt = time.Now()
+}
+
+// Print writes human readable summary of named component
+func (s *State) Print(w io.Writer, name string) error {
+	c, ok := s.Components[name]
+	if !ok {
+		_, err := fmt.Fprintf(w, "%s was not deployed to cluster %s\n", name, s.Cluster)
+		return err
+	}
+	fmt.Fprintf(w, "Cluster:        %s\n", s.Cluster)
+	fmt.Fprintf(w, "Version:        %s\n", c.BinaryVersion)
+	fmt.Fprintf(w, "Updated:        %s\n\n", c.UpdatedAt.Format(time.RFC3339))
+
+	names := make([]string, 0, len(c.Hosts))
+	for name := range c.Hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "AGENT\tADDRESS\tROLE\tVERSION\tSTEPS\tUPDATED")
+	for _, name := range names {
+		h := c.Hosts[name]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n",
+			name, h.Address, h.Role, h.BinaryVersion, len(h.Steps), h.UpdatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,104 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestLock(t *testing.T) {
+	inTempDir(t)
+	s, err := Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(Dir, "dc1.lock")
+	_, err = Open("dc1")
+	if err == nil {
+		t.Fatal("second open of locked state succeeded")
+	}
+	if !strings.Contains(err.Error(), "rm "+lockPath) {
+		t.Errorf("error doesn't tell how to remove lock file: %s", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open("dc1")
+	if err != nil {
+		t.Fatalf("open after close failed: %s", err)
+	}
+	s.Close()
+}
+
+func TestAbort(t *testing.T) {
+	inTempDir(t)
+	s, err := Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := false
+	s.BeforeSave(func() error {
+		saved = true
+		return nil
+	})
+	s.Component("consul").MarkStep("binary")
+
+	Abort()
+	if !saved {
+		t.Error("hooks are not run on abort")
+	}
+	if _, err := os.Stat(filepath.Join(Dir, "dc1.lock")); !os.IsNotExist(err) {
+		t.Errorf("lock is not released on abort: %v", err)
+	}
+	s, err = Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, done := s.Component("consul").Steps["binary"]; !done {
+		t.Error("state is not saved on abort")
+	}
+}
+
+func TestReadWithoutLock(t *testing.T) {
+	inTempDir(t)
+	s, err := Open("dc1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Component("nomad").MarkStep("binary")
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := Read("dc1")
+	if err != nil {
+		t.Fatalf("read of locked state failed: %s", err)
+	}
+	if _, done := read.Components["nomad"].Steps["binary"]; !done {
+		t.Error("read state has no saved step")
+	}
+	if err := read.Save(); err == nil {
+		t.Error("state read without lock is saved")
+	}
+	if err := read.Close(); err != nil {
+		t.Errorf("close of read state failed: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(Dir, "dc1.lock")); err != nil {
+		t.Errorf("close of read state released the lock: %v", err)
+	}
+}